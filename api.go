@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is the body of every failed API response.
+type APIError struct {
+	Error string
+}
+
+// FeedInput is the body of the API requests creating or updating a feed.
+type FeedInput struct {
+	URL            string
+	IsHidden       bool
+	RetentionDays  int
+	RetentionCount int
+	KeepForever    bool
+	Folder         string
+}
+
+// apiRoute registers a JSON API controller. Controllers return the status
+// along with the data to encode, a nil data answering with no body.
+func apiRoute(path string, d *sql.DB, controller func(*sql.DB, *http.Request) (int, interface{}, error)) {
+	http.HandleFunc(path, authenticated(d, sameOriginOnly(func(w http.ResponseWriter, r *http.Request) {
+		var status int
+		var data interface{}
+		err := r.ParseForm()
+		if err == nil {
+			status, data, err = controller(d, r)
+		} else {
+			err = badRequest(err)
+		}
+		if err != nil {
+			status = errorStatus(err)
+			data = APIError{Error: errorMessage(r, status, err)}
+		}
+
+		if data == nil {
+			w.WriteHeader(status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		err = json.NewEncoder(w).Encode(data)
+		if err != nil {
+			panic(err)
+		}
+	}), apiUnauthorized))
+}
+
+func apiUnauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="rss", charset="UTF-8"`)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	err := json.NewEncoder(w).Encode(APIError{Error: "authentication required"})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// decodeJSON reads the request body into v.
+func decodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err != nil {
+		return badRequest(fmt.Errorf("invalid body: %w", err))
+	}
+
+	return nil
+}
+
+// apiPrefix is the path the JSON API is served under.
+const apiPrefix = "/api/v1/"
+
+type APIController struct{}
+
+// apiNotFound answers the API requests no route matches, with 405 and the
+// allowed methods when the path is routed for other methods.
+func apiNotFound(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		_, pattern := http.DefaultServeMux.Handler(probe)
+		if pattern != apiPrefix {
+			allowed = append(allowed, method)
+		}
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeError(w, r, http.StatusNotFound, "not found")
+}
+
+func (a *APIController) ListFeeds(d *sql.DB, r *http.Request) (int, interface{}, error) {
+	feeds, err := listFeeds(r.Context(), d, currentUser(r).Id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, feeds, nil
+}
+
+// saveFeed subscribes the user to the feed described by the request body, left
+// for the scheduler to fetch, moving the subscription to feed over when its URL
+// changed.
+func (a *APIController) saveFeed(d *sql.DB, r *http.Request, feed *Feed) error {
+	var input FeedInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		return err
+	}
+
+	input.URL = strings.TrimSpace(input.URL)
+	switch {
+	case input.URL == "":
+		return badRequest(errors.New("URL is required"))
+	case input.RetentionDays < 0 || input.RetentionCount < 0:
+		return badRequest(errors.New("retention must not be negative"))
+	}
+
+	user := currentUser(r)
+	previous := Feed{Id: feed.Id}
+	feed.URL = input.URL
+	feed.IsHidden = input.IsHidden
+	feed.RetentionDays = input.RetentionDays
+	feed.RetentionCount = input.RetentionCount
+	feed.KeepForever = input.KeepForever
+	err = feed.add(r.Context(), d)
+	if err != nil {
+		return err
+	}
+
+	err = feed.subscribe(r.Context(), d, user.Id)
+	if err != nil {
+		return err
+	}
+	notifyFeedsDue(r.Context(), d)
+
+	if previous.Id != 0 && previous.Id != feed.Id {
+		err = previous.unsubscribe(r.Context(), d, user.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return feed.setFolder(r.Context(), d, user.Id, input.Folder)
+}
+
+func (a *APIController) CreateFeed(d *sql.DB, r *http.Request) (int, interface{}, error) {
+	var feed Feed
+	err := a.saveFeed(d, r, &feed)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusCreated, feed, nil
+}
+
+func (a *APIController) UpdateFeed(d *sql.DB, r *http.Request) (int, interface{}, error) {
+	feed := Feed{Id: idPathValue(r)}
+	err := d.
+		QueryRowContext(r.Context(), "SELECT feed_id FROM subscriptions WHERE feed_id = $1 AND user_id = $2", feed.Id, currentUser(r).Id).
+		Scan(&feed.Id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = a.saveFeed(d, r, &feed)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, feed, nil
+}
+
+func (a *APIController) DeleteFeed(d *sql.DB, r *http.Request) (int, interface{}, error) {
+	feed := Feed{Id: idPathValue(r)}
+	err := feed.unsubscribe(r.Context(), d, currentUser(r).Id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+// ListEntries returns a page of the entries matching the same form values as
+// Index, pages being walked with the Older and Newer cursors of the response.
+func (a *APIController) ListEntries(d *sql.DB, r *http.Request) (int, interface{}, error) {
+	filter := parseFeedEntryFilter(r.Form)
+	filter.userId = currentUser(r).Id
+	page, err := filter.page(r.Context(), d)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, page, nil
+}
+
+func (a *APIController) GetEntry(d *sql.DB, r *http.Request) (int, interface{}, error) {
+	feedEntry := FeedEntry{Id: idPathValue(r)}
+	err := feedEntry.load(r.Context(), d, currentUser(r).Id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, feedEntry, nil
+}
+
+func (a *APIController) SetRead(d *sql.DB, r *http.Request) (int, interface{}, error) {
+	feedEntry := FeedEntry{Id: idPathValue(r)}
+	err := feedEntry.setRead(r.Context(), d, currentUser(r).Id, r.Method != http.MethodDelete)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+func (a *APIController) SetStarred(d *sql.DB, r *http.Request) (int, interface{}, error) {
+	feedEntry := FeedEntry{Id: idPathValue(r)}
+	err := feedEntry.setStarred(r.Context(), d, currentUser(r).Id, r.Method != http.MethodDelete)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	requestIdContextKey
+)
+
+const sessionCookie = "session"
+
+// authenticate returns the user signed in by the session cookie or, for feed
+// readers and scripts, by HTTP basic authentication. It returns nil when
+// nobody is signed in.
+func authenticate(d *sql.DB, r *http.Request) (*User, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err == nil {
+		user, err := sessionUser(r.Context(), d, cookie.Value)
+		if err == nil {
+			return user, nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+
+	user, err := checkCredentials(r, d, username, password)
+	if errors.Is(err, errInvalidCredentials) {
+		return nil, nil
+	}
+
+	return user, err
+}
+
+const (
+	// checkedCredentialsDuration is how long credentials that signed in are
+	// trusted without checking the password again.
+	checkedCredentialsDuration = time.Minute
+	// maxFailedSignIns is the number of failed sign ins of an address after
+	// which its sign ins are refused until failedSignInsWindow has passed
+	// since the first one.
+	maxFailedSignIns    = 10
+	failedSignInsWindow = 15 * time.Minute
+)
+
+var errTooManySignIns = &statusError{
+	status: http.StatusTooManyRequests,
+	err:    errors.New("too many failed sign ins, try again later"),
+}
+
+// signIns remembers the credentials that signed in lately, so that clients
+// sending them along with every request do not have the password hashed each
+// time, and the failed sign ins of each address, to slow down guessing.
+// Credentials are remembered by their HMAC under a key of the process.
+var signIns = struct {
+	sync.Mutex
+	key      []byte
+	checked  map[string]checkedCredentials
+	failures map[string]failedSignIns
+}{
+	key:      randomKey(),
+	checked:  map[string]checkedCredentials{},
+	failures: map[string]failedSignIns{},
+}
+
+type checkedCredentials struct {
+	user      User
+	expiresAt time.Time
+}
+
+type failedSignIns struct {
+	count int
+	since time.Time
+}
+
+func randomKey() []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		panic(err)
+	}
+
+	return key
+}
+
+// checkCredentials returns the user with username and password like
+// authenticateUser, failing with errTooManySignIns when the address of the
+// request failed to sign in too often lately.
+func checkCredentials(r *http.Request, d *sql.DB, username string, password string) (*User, error) {
+	key := credentialsKey(username, password)
+	addr := remoteHost(r)
+	now := time.Now()
+
+	signIns.Lock()
+	checked, ok := signIns.checked[key]
+	failures := signIns.failures[addr]
+	signIns.Unlock()
+	if ok && now.Before(checked.expiresAt) {
+		user := checked.user
+		return &user, nil
+	}
+	if failures.count >= maxFailedSignIns && now.Before(failures.since.Add(failedSignInsWindow)) {
+		return nil, errTooManySignIns
+	}
+
+	user, err := authenticateUser(r.Context(), d, username, password)
+	if err != nil && !errors.Is(err, errInvalidCredentials) {
+		return nil, err
+	}
+
+	signIns.Lock()
+	defer signIns.Unlock()
+	pruneSignIns(now)
+	if err != nil {
+		failures := signIns.failures[addr]
+		if failures.count == 0 {
+			failures.since = now
+		}
+		failures.count++
+		signIns.failures[addr] = failures
+		return nil, err
+	}
+	signIns.checked[key] = checkedCredentials{user: *user, expiresAt: now.Add(checkedCredentialsDuration)}
+
+	return user, nil
+}
+
+// credentialsKey returns the key credentials are remembered by.
+func credentialsKey(username string, password string) string {
+	mac := hmac.New(sha256.New, signIns.key)
+	mac.Write([]byte(username + "\x00" + password))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// pruneSignIns forgets the credentials and failures that expired. signIns
+// must be locked.
+func pruneSignIns(now time.Time) {
+	for key, checked := range signIns.checked {
+		if !now.Before(checked.expiresAt) {
+			delete(signIns.checked, key)
+		}
+	}
+	for addr, failures := range signIns.failures {
+		if !now.Before(failures.since.Add(failedSignInsWindow)) {
+			delete(signIns.failures, addr)
+		}
+	}
+}
+
+// remoteHost returns the address the request comes from, without its port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// authenticated wraps handler so that it only runs for signed in users, the
+// others being handed to unauthorized.
+func authenticated(d *sql.DB, handler http.HandlerFunc, unauthorized http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := authenticate(d, r)
+		if errors.Is(err, errTooManySignIns) {
+			writeError(w, r, errTooManySignIns.status, err.Error())
+			return
+		} else if err != nil {
+			panic(err)
+		}
+		if user == nil {
+			unauthorized(w, r)
+			return
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	}
+}
+
+// currentUser returns the signed in user of a request let through by
+// authenticated, nil otherwise.
+func currentUser(r *http.Request) *User {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	return user
+}
+
+func redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	next := ""
+	if r.Method == http.MethodGet {
+		next = "?Next=" + r.URL.RequestURI()
+	}
+	http.Redirect(w, r, "/login"+next, http.StatusSeeOther)
+}
+
+func basicAuthRequired(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="rss", charset="UTF-8"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// localPath returns path when it stays on this site, "/" otherwise.
+func localPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+
+	return path
+}
+
+type SessionsController struct{}
+
+func (s *SessionsController) GetLogin(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	return &Response{Data: LoginForm{Next: localPath(r.FormValue("Next"))}}, "html/login.html", nil
+}
+
+// LoginForm is the data of the login page.
+type LoginForm struct {
+	Username string
+	Next     string
+	Error    string
+}
+
+func (s *SessionsController) SetLogin(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	form := LoginForm{
+		Username: r.FormValue("Username"),
+		Next:     localPath(r.FormValue("Next")),
+	}
+
+	user, err := checkCredentials(r, d, form.Username, r.FormValue("Password"))
+	if errors.Is(err, errInvalidCredentials) {
+		form.Error = "Invalid username or password"
+		return &Response{Data: form}, "html/login.html", nil
+	} else if errors.Is(err, errTooManySignIns) {
+		form.Error = "Too many failed sign ins, try again later"
+		return &Response{Data: form}, "html/login.html", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	err = user.setFeverKey(r.Context(), d, r.FormValue("Password"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, expiresAt, err := user.newSession(r.Context(), d)
+	if err != nil {
+		return nil, "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, form.Next, http.StatusSeeOther)
+
+	return nil, "", nil
+}
+
+func (s *SessionsController) Logout(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err == nil {
+		err := deleteSession(r.Context(), d, cookie.Value)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+
+	return nil, "", nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func resetSignIns(t *testing.T) {
+	reset := func() {
+		signIns.Lock()
+		defer signIns.Unlock()
+		signIns.checked = map[string]checkedCredentials{}
+		signIns.failures = map[string]failedSignIns{}
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// The database is nil in these tests: the password must not be checked.
+
+func TestCheckCredentialsRemembered(t *testing.T) {
+	resetSignIns(t)
+	signIns.checked[credentialsKey("ana", "secret")] = checkedCredentials{
+		user:      User{Id: 3, Username: "ana"},
+		expiresAt: time.Now().Add(time.Minute),
+	}
+
+	user, err := checkCredentials(httptest.NewRequest("GET", "/", nil), nil, "ana", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Id != 3 {
+		t.Errorf("user = %+v, want the user 3", user)
+	}
+}
+
+func TestCheckCredentialsTooManyFailures(t *testing.T) {
+	resetSignIns(t)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	signIns.failures["192.0.2.1"] = failedSignIns{count: maxFailedSignIns, since: time.Now()}
+
+	_, err := checkCredentials(r, nil, "ana", "guess")
+	if !errors.Is(err, errTooManySignIns) {
+		t.Errorf("err = %v, want errTooManySignIns", err)
+	}
+}
+
+func TestRemoteHost(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"192.0.2.1:1234", "192.0.2.1"},
+		{"[2001:db8::1]:1234", "2001:db8::1"},
+		{"unix", "unix"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if got := remoteHost(r); got != test.want {
+			t.Errorf("remoteHost(%q) = %q, want %q", test.remoteAddr, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	DatabaseURL string
+	// ListenAddr is the address the web server listens on, serving HTTPS when
+	// TLSCert and TLSKey are set.
+	ListenAddr string
+	TLSCert    string
+	TLSKey     string
+	// FetchConcurrency is the number of feeds fetched at once.
+	FetchConcurrency int
+	// RefreshInterval is how long a feed waits after a fetch before the next
+	// one, and PollInterval how often feeds due for a fetch are looked for.
+	RefreshInterval time.Duration
+	PollInterval    time.Duration
+	// RetentionDays is how long entries are kept for subscriptions without
+	// their own max age. Zero keeps them forever.
+	RetentionDays int
+	// UserAgent is sent along with the feed requests.
+	UserAgent string
+	LogLevel  slog.Level
+	// LogFormat is "text" or "json".
+	LogFormat string
+	// APISecret signs the Google Reader tokens, changing it signing out every
+	// client. A random secret is used when it is not set, signing the clients
+	// out on every restart.
+	APISecret string
+}
+
+// configOption is a setting that can be given as the flag name, as the
+// RSS_NAME environment variable, name being in upper case with dashes replaced
+// by underscores, or as a "name = value" line of the config file.
+type configOption struct {
+	name  string
+	usage string
+	set   func(config *Config, value string) error
+}
+
+var configOptions = []configOption{
+	{"database-url", "PostgreSQL connection string", func(c *Config, v string) error {
+		c.DatabaseURL = v
+		return nil
+	}},
+	{"listen", "address to listen on", func(c *Config, v string) error {
+		c.ListenAddr = v
+		return nil
+	}},
+	{"tls-cert", "TLS certificate file, serving HTTPS along with tls-key", func(c *Config, v string) error {
+		c.TLSCert = v
+		return nil
+	}},
+	{"tls-key", "TLS key file", func(c *Config, v string) error {
+		c.TLSKey = v
+		return nil
+	}},
+	{"fetch-concurrency", "number of feeds fetched at once", func(c *Config, v string) error {
+		return parseInt(v, &c.FetchConcurrency)
+	}},
+	{"refresh-interval", "time between two fetches of a feed", func(c *Config, v string) error {
+		return parseDuration(v, &c.RefreshInterval)
+	}},
+	{"poll-interval", "time between two looks for feeds to fetch", func(c *Config, v string) error {
+		return parseDuration(v, &c.PollInterval)
+	}},
+	{"retention-days", "days entries are kept for by default, 0 keeping them forever", func(c *Config, v string) error {
+		return parseInt(v, &c.RetentionDays)
+	}},
+	{"user-agent", "User-Agent of the feed requests", func(c *Config, v string) error {
+		c.UserAgent = v
+		return nil
+	}},
+	{"log-level", "debug, info, warn or error", func(c *Config, v string) error {
+		return c.LogLevel.UnmarshalText([]byte(v))
+	}},
+	{"log-format", "text or json", func(c *Config, v string) error {
+		c.LogFormat = v
+		return nil
+	}},
+	{"api-secret", "secret signing the Google Reader API tokens", func(c *Config, v string) error {
+		c.APISecret = v
+		return nil
+	}},
+}
+
+func parseInt(value string, target *int) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", value)
+	}
+	*target = n
+
+	return nil
+}
+
+func parseDuration(value string, target *time.Duration) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", value)
+	}
+	*target = duration
+
+	return nil
+}
+
+func (o configOption) envName() string {
+	return "RSS_" + strings.ToUpper(strings.ReplaceAll(o.name, "-", "_"))
+}
+
+// loadConfig reads the configuration from the config file, the environment
+// and the command line args, each overriding the previous ones, and returns it
+// along with the args left after the flags.
+func loadConfig(args []string) (*Config, []string, error) {
+	config := Config{
+		DatabaseURL:      "postgres://postgres@:5432/rss?sslmode=disable",
+		ListenAddr:       ":8080",
+		FetchConcurrency: 5,
+		RefreshInterval:  10 * time.Minute,
+		PollInterval:     5 * time.Minute,
+		RetentionDays:    30,
+		UserAgent:        "rss-app",
+		LogLevel:         slog.LevelInfo,
+		LogFormat:        "text",
+	}
+
+	flags := flag.NewFlagSet("rss-app", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("RSS_CONFIG"), "config file of \"name = value\" lines")
+	flagValues := map[string]*string{}
+	for _, option := range configOptions {
+		flagValues[option.name] = flags.String(option.name, "", option.usage+" ($"+option.envName()+")")
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		err := config.readFile(*configFile)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, option := range configOptions {
+		if value, ok := os.LookupEnv(option.envName()); ok {
+			err := option.set(&config, value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", option.envName(), err)
+			}
+		}
+	}
+
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		for _, option := range configOptions {
+			if option.name == f.Name && flagErr == nil {
+				err := option.set(&config, *flagValues[option.name])
+				if err != nil {
+					flagErr = fmt.Errorf("-%s: %w", option.name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, nil, flagErr
+	}
+
+	err = config.validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &config, flags.Args(), nil
+}
+
+// readFile applies the "name = value" lines of the config file at path. Empty
+// lines and lines starting with # are skipped.
+func (c *Config) readFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(text, "=")
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+		if !ok {
+			return fmt.Errorf("%s:%d: expected name = value", path, line)
+		}
+
+		found := false
+		for _, option := range configOptions {
+			if option.name == name {
+				found = true
+				err := option.set(c, value)
+				if err != nil {
+					return fmt.Errorf("%s:%d: %s: %w", path, line, name, err)
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, line, name)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// validate checks that the settings make sense together.
+func (c *Config) validate() error {
+	switch {
+	case c.DatabaseURL == "":
+		return errors.New("database-url is required")
+	case c.FetchConcurrency < 1:
+		return errors.New("fetch-concurrency must be at least 1")
+	case c.RefreshInterval <= 0:
+		return errors.New("refresh-interval must be positive")
+	case c.PollInterval <= 0:
+		return errors.New("poll-interval must be positive")
+	case c.RetentionDays < 0:
+		return errors.New("retention-days must not be negative")
+	case c.UserAgent == "":
+		return errors.New("user-agent is required")
+	case c.LogFormat != "text" && c.LogFormat != "json":
+		return fmt.Errorf("log-format: unknown format %q", c.LogFormat)
+	case (c.TLSCert == "") != (c.TLSKey == ""):
+		return errors.New("tls-cert and tls-key go together")
+	}
+
+	_, _, err := net.SplitHostPort(c.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	for _, file := range []string{c.TLSCert, c.TLSKey} {
+		if file == "" {
+			continue
+		}
+		_, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+	}
+
+	return nil
+}
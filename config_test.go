@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// clearConfigEnv unsets the RSS_ variables for the duration of the test.
+func clearConfigEnv(t *testing.T) {
+	names := []string{"RSS_CONFIG"}
+	for _, option := range configOptions {
+		names = append(names, option.envName())
+	}
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "rss.conf")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, `
+# comment
+listen = :8001
+user-agent = from-file
+poll-interval = 1m
+`)
+	t.Setenv("RSS_CONFIG", path)
+	t.Setenv("RSS_LISTEN", ":8002")
+	t.Setenv("RSS_USER_AGENT", "from-env")
+	t.Setenv("RSS_RETENTION_DAYS", "7")
+
+	config, args, err := loadConfig([]string{"-listen", ":8003", "-retention-days", "0", "refresh", "12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"flag over env and file", config.ListenAddr, ":8003"},
+		{"flag over env", config.RetentionDays, 0},
+		{"env over file", config.UserAgent, "from-env"},
+		{"file over default", config.PollInterval, time.Minute},
+		{"default", config.FetchConcurrency, 5},
+		{"args", args, []string{"refresh", "12"}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadConfigConfigFlag(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("RSS_CONFIG", writeConfigFile(t, "user-agent = from-env-file\n"))
+	path := writeConfigFile(t, "user-agent = from-flag-file\n")
+
+	config, _, err := loadConfig([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.UserAgent != "from-flag-file" {
+		t.Errorf("UserAgent = %q, want %q", config.UserAgent, "from-flag-file")
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+	}{
+		{"unknown setting", "colour = blue\n", nil, nil},
+		{"line without value", "listen\n", nil, nil},
+		{"bad number in file", "fetch-concurrency = many\n", nil, nil},
+		{"bad duration in env", "", map[string]string{"RSS_POLL_INTERVAL": "soon"}, nil},
+		{"bad log level flag", "", nil, []string{"-log-level", "loud"}},
+		{"invalid value", "", map[string]string{"RSS_FETCH_CONCURRENCY": "0"}, nil},
+		{"cert without key", "", nil, []string{"-tls-cert", "cert.pem"}},
+		{"bad listen address", "", nil, []string{"-listen", "8080"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			if test.file != "" {
+				t.Setenv("RSS_CONFIG", writeConfigFile(t, test.file))
+			}
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			_, _, err := loadConfig(append([]string{}, test.args...))
+			if err == nil {
+				t.Error("loadConfig succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+)
+
+const csrfFormValue = "CSRFToken"
+
+// csrfToken returns the token the forms of the session of the request send
+// back, empty when there is no session.
+func csrfToken(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, []byte(cookie.Value))
+	mac.Write([]byte("csrf"))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// safeMethod reports whether requests with method leave everything as is.
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// sameOrigin reports whether the request comes from a page of this site. Clients
+// other than browsers send neither Sec-Fetch-Site nor Origin and are let through.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+
+	return err == nil && u.Host == r.Host
+}
+
+// sameOriginOnly rejects the requests changing state that come from other
+// sites.
+func sameOriginOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !safeMethod(r.Method) && !sameOrigin(r) {
+			http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// csrfProtected rejects the requests changing state that come from other sites
+// or lack the CSRF token of the session.
+func csrfProtected(handler http.HandlerFunc) http.HandlerFunc {
+	return sameOriginOnly(func(w http.ResponseWriter, r *http.Request) {
+		if !safeMethod(r.Method) {
+			token := csrfToken(r)
+			if token == "" || !hmac.Equal([]byte(r.PostFormValue(csrfFormValue)), []byte(token)) {
+				http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		handler(w, r)
+	})
+}
@@ -2,7 +2,6 @@ package main
 
 import "database/sql"
 
-func newDB() (*sql.DB, error) {
-	const DatabaseURL = "postgres://postgres@:5432/rss?sslmode=disable"
-	return sql.Open("postgres", DatabaseURL)
+func newDB(databaseURL string) (*sql.DB, error) {
+	return sql.Open("postgres", databaseURL)
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"rss-app/html"
+	"strings"
+)
+
+// statusError is an error answered with a given HTTP status.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+func badRequest(err error) error {
+	return &statusError{status: http.StatusBadRequest, err: err}
+}
+
+// errorStatus returns the HTTP status a request failing with err is answered
+// with.
+func errorStatus(err error) int {
+	var statusErr *statusError
+	var fetchErr *fetchError
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.status
+	case errors.As(err, &fetchErr):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errorMessage returns the message a request failing with err is answered
+// with. Internal errors are logged instead of being shown.
+func errorMessage(r *http.Request, status int, err error) string {
+	switch {
+	case status == http.StatusInternalServerError:
+		slog.ErrorContext(r.Context(), "request failed", "request_id", requestId(r), "method", r.Method, "path", r.URL.Path, "error", err)
+		return http.StatusText(status)
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusText(status)
+	default:
+		return err.Error()
+	}
+}
+
+// ErrorPage is the data of html/error.html.
+type ErrorPage struct {
+	Status    int
+	Title     string
+	Message   string
+	RequestId string
+}
+
+// writeError answers the request with the status and message, as JSON for the
+// API and as an error page otherwise.
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(APIError{Error: message})
+		return
+	}
+
+	response := &Response{
+		Data: ErrorPage{
+			Status:    status,
+			Title:     http.StatusText(status),
+			Message:   message,
+			RequestId: requestId(r),
+		},
+		User:      currentUser(r),
+		CSRFToken: csrfToken(r),
+	}
+	var page bytes.Buffer
+	err := html.ParseWithFilter("html/error.html").Execute(&page, &response)
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	page.WriteTo(w)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FeedEvent tells the browsers that a feed has been updated. Kind is
+// "feed_updated", "new_entries" when the update brought new entries, or
+// "feed_error".
+type FeedEvent struct {
+	Kind       string
+	FeedId     int
+	NewEntries int64  `json:",omitempty"`
+	Error      string `json:",omitempty"`
+}
+
+// feedEventsChannel is the PostgreSQL channel the FeedEvents go through, so
+// that every instance streams the updates made by any of them.
+const feedEventsChannel = "feed_events"
+
+// publishFeedEvents sends the events of an update of the feed to every
+// instance. A failure is only logged, the events being a convenience.
+func publishFeedEvents(d *sql.DB, feed *Feed, newEntries int64, err error) {
+	var events []FeedEvent
+	if err != nil {
+		// Notification payloads are limited to 8000 bytes.
+		message := err.Error()
+		if len(message) > 1000 {
+			message = message[:1000]
+		}
+		events = append(events, FeedEvent{Kind: "feed_error", FeedId: feed.Id, Error: message})
+	} else {
+		events = append(events, FeedEvent{Kind: "feed_updated", FeedId: feed.Id, NewEntries: newEntries})
+		if newEntries > 0 {
+			events = append(events, FeedEvent{Kind: "new_entries", FeedId: feed.Id, NewEntries: newEntries})
+		}
+	}
+
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			panic(err)
+		}
+		_, err = d.ExecContext(context.Background(), "SELECT pg_notify($1, $2)", feedEventsChannel, string(payload))
+		if err != nil {
+			slog.Warn("publish feed event", "feed_id", feed.Id, "error", err)
+		}
+	}
+}
+
+// feedEventHub hands the events received on feedEventsChannel to the open
+// event streams.
+type feedEventHub struct {
+	mu      sync.Mutex
+	streams map[chan FeedEvent]struct{}
+}
+
+var feedEvents = &feedEventHub{streams: map[chan FeedEvent]struct{}{}}
+
+func (h *feedEventHub) subscribe() chan FeedEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stream := make(chan FeedEvent, 16)
+	h.streams[stream] = struct{}{}
+
+	return stream
+}
+
+func (h *feedEventHub) unsubscribe(stream chan FeedEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.streams, stream)
+}
+
+// publish hands the event to every stream, skipping the ones too slow to keep
+// up rather than waiting for them.
+func (h *feedEventHub) publish(event FeedEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for stream := range h.streams {
+		select {
+		case stream <- event:
+		default:
+		}
+	}
+}
+
+// listenFeedEvents hands the events published by every instance to feedEvents
+// for as long as the process runs.
+func listenFeedEvents(config *Config) {
+	listener, notifications := listen(config, feedEventsChannel)
+	if listener == nil {
+		return
+	}
+	defer listener.Close()
+
+	for notification := range notifications {
+		if notification == nil {
+			continue
+		}
+
+		var event FeedEvent
+		err := json.Unmarshal([]byte(notification.Extra), &event)
+		if err != nil {
+			slog.Warn("feed event", "payload", notification.Extra, "error", err)
+			continue
+		}
+		feedEvents.publish(event)
+	}
+}
+
+// Events streams the FeedEvents of the feeds the user is subscribed to as
+// server-sent events.
+func Events(d *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := currentUser(r)
+		controller := http.NewResponseController(w)
+
+		stream := feedEvents.subscribe()
+		defer feedEvents.unsubscribe(stream)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		err := controller.Flush()
+		if err != nil {
+			return
+		}
+
+		// Proxies drop connections idle for too long.
+		keepAlive := time.NewTicker(30 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case event := <-stream:
+				var subscribed bool
+				err := d.
+					QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM subscriptions WHERE user_id = $1 AND feed_id = $2)", user.Id, event.FeedId).
+					Scan(&subscribed)
+				if err != nil {
+					return
+				}
+				if !subscribed {
+					continue
+				}
+
+				data, err := json.Marshal(event)
+				if err != nil {
+					panic(err)
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, data)
+			}
+
+			err := controller.Flush()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// eventsUnauthorized answers the event streams of visitors not signed in,
+// which EventSource gives up on.
+func eventsUnauthorized(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -4,155 +4,405 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"html/template"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"rss-app/rss"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Feed struct {
-	Id       int
-	URL      string
-	IsHidden bool
+	Id             int
+	URL            string
+	IsHidden       bool
+	UnreadCount    int
+	RetentionDays  int
+	RetentionCount int
+	KeepForever    bool
+	FolderId       int
+	Folder         string
+	// Format is the format of the document last fetched, such as "RSS 2.0".
+	Format string
+	// LastError is the error of the last update, empty when it succeeded.
+	LastError  string
+	IsUpdating bool
+	// IsDisabled is set after feedMaxFailures failed updates in a row.
+	IsDisabled bool
+	// Fetches is the latest history of the feed, only loaded by the page of
+	// the feed.
+	Fetches []FeedFetch `json:",omitempty"`
 	rss.Channel
 }
 
-type FeedsController struct{}
+type FeedsController struct {
+	// refreshInterval is the time until the next update of a refreshed feed.
+	refreshInterval time.Duration
+}
 
-func (f *FeedsController) Show(d *sql.DB, w http.ResponseWriter, r *http.Request) {
-	rows, err := d.
-		QueryContext(r.Context(), `
+// FeedDetail is the data of the page of a feed.
+type FeedDetail struct {
+	Feed
+	UpdateAt   time.Time
+	EntryCount int
+	// AverageLength is the average number of characters of the entries, their
+	// markup left out.
+	AverageLength int
+	// Weeks counts the entries published in each of the last weeks, the
+	// latest last.
+	Weeks        []WeekCount
+	PostsPerWeek float64
+}
+
+type WeekCount struct {
+	Start time.Time
+	Count int
+	// Percent is Count relative to the busiest week.
+	Percent int
+}
+
+// feedDetailWeeks is the number of weeks the posting frequency covers.
+const feedDetailWeeks = 26
+
+// Show renders the page of a feed the user is subscribed to, with its settings,
+// the state of its updates and statistics about its entries.
+func (f *FeedsController) Show(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	var detail FeedDetail
+	err := d.
+		QueryRowContext(r.Context(), `
 			SELECT
+				feeds.id,
+				feeds.url,
 				feeds.title,
-				feed_entries.title,
-				feed_entries.link,
-				feed_entries.description
-			FROM
-				feeds,
-				feed_entries
-			WHERE
-				feeds.id = feed_entries.feed_id AND
-				feeds.id = $1`, r.PathValue("Id"))
+				feeds.link,
+				feeds.description,
+				feeds.format,
+				subscriptions.is_hidden,
+				subscriptions.retention_days,
+				subscriptions.retention_count,
+				subscriptions.keep_forever,
+				COALESCE(folders.name, ''),
+				feeds.last_error,
+				feeds.is_updating,
+				feeds.is_disabled,
+				feeds.update_at
+			FROM feeds
+			JOIN subscriptions ON subscriptions.feed_id = feeds.id
+			LEFT JOIN folders ON folders.id = subscriptions.folder_id
+			WHERE feeds.id = $1 AND subscriptions.user_id = $2`, idPathValue(r), currentUser(r).Id).
+		Scan(&detail.Id, &detail.URL, &detail.Title, &detail.Link, &detail.Description, &detail.Format, &detail.IsHidden, &detail.RetentionDays, &detail.RetentionCount, &detail.KeepForever, &detail.Folder, &detail.LastError, &detail.IsUpdating, &detail.IsDisabled, &detail.UpdateAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = d.
+		QueryRowContext(r.Context(), `
+			SELECT
+				COUNT(*),
+				COALESCE(AVG(LENGTH(regexp_replace(
+					CASE WHEN content <> '' THEN content ELSE description END, '<[^>]*>', '', 'g'))), 0)::int
+			FROM feed_entries
+			WHERE feed_id = $1`, detail.Id).
+		Scan(&detail.EntryCount, &detail.AverageLength)
 	if err != nil {
-		panic(err)
+		return nil, "", err
 	}
 
-	var feed Feed
+	detail.Weeks, err = weekCounts(r.Context(), d, detail.Id)
+	if err != nil {
+		return nil, "", err
+	}
+	total, busiest := 0, 0
+	for _, week := range detail.Weeks {
+		total += week.Count
+		busiest = max(busiest, week.Count)
+	}
+	for i := range detail.Weeks {
+		if busiest > 0 {
+			detail.Weeks[i].Percent = detail.Weeks[i].Count * 100 / busiest
+		}
+	}
+	detail.PostsPerWeek = float64(total) / feedDetailWeeks
+
+	detail.Fetches, err = listFeedFetches(r.Context(), d, detail.Id, 20)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &Response{Data: detail}, "html/feeds/show.html", nil
+}
+
+// weekCounts counts the entries of the feed published in each of the last
+// feedDetailWeeks weeks.
+func weekCounts(ctx context.Context, d *sql.DB, feedId int) ([]WeekCount, error) {
+	rows, err := d.
+		QueryContext(ctx, `
+			SELECT weeks.start, COUNT(feed_entries.id)
+			FROM generate_series(
+				date_trunc('week', NOW()) - make_interval(weeks => $2),
+				date_trunc('week', NOW()),
+				interval '1 week') AS weeks(start)
+			LEFT JOIN feed_entries ON
+				feed_entries.feed_id = $1 AND
+				feed_entries.pub_date >= weeks.start AND
+				feed_entries.pub_date < weeks.start + interval '1 week'
+			GROUP BY weeks.start
+			ORDER BY weeks.start`, feedId, feedDetailWeeks-1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var weeks []WeekCount
 	for {
-		hasRow := rows.Next()
-		if !hasRow {
+		if !rows.Next() {
 			if rows.Err() != nil {
-				panic(rows.Err())
+				return nil, rows.Err()
 			}
 			break
 		}
 
-		var title string
-		var item rss.Item
-		err := rows.Scan(&title, &item.Title, &item.Link, &item.Description)
+		var week WeekCount
+		err := rows.Scan(&week.Start, &week.Count)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-
-		feed.Title = title
-		feed.Items = append(feed.Items, item)
+		weeks = append(weeks, week)
 	}
 
-	tmplt, err := template.ParseFiles("pages/feed.html")
-	if err != nil {
-		panic(err)
-	}
-
-	err = tmplt.Execute(w, feed)
-	if err != nil {
-		panic(err)
-	}
+	return weeks, nil
 }
 
 func (f *FeedsController) GetEdit(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
 	var feed Feed
 	err := d.
-		QueryRowContext(r.Context(), "SELECT id, url, is_hidden FROM feeds WHERE id = $1", idPathValue(r)).
-		Scan(&feed.Id, &feed.URL, &feed.IsHidden)
+		QueryRowContext(r.Context(), `
+			SELECT
+				feeds.id,
+				feeds.url,
+				subscriptions.is_hidden,
+				subscriptions.retention_days,
+				subscriptions.retention_count,
+				subscriptions.keep_forever,
+				COALESCE(folders.name, '')
+			FROM feeds
+			JOIN subscriptions ON subscriptions.feed_id = feeds.id
+			LEFT JOIN folders ON folders.id = subscriptions.folder_id
+			WHERE feeds.id = $1 AND subscriptions.user_id = $2`, idPathValue(r), currentUser(r).Id).
+		Scan(&feed.Id, &feed.URL, &feed.IsHidden, &feed.RetentionDays, &feed.RetentionCount, &feed.KeepForever, &feed.Folder)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return nil, "", err
 	}
 
-	return &Response{Data: feed}, "html/feeds/edit.html", nil
-}
-
-func (f *Feed) update(d *sql.DB) error {
-	rss, err := rss.New(f.URL)
+	filterOptions, err := filterOptions(d, currentUser(r).Id)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
-	f.Channel = rss.Channels[0]
+	return &Response{Data: feed, FilterOptions: *filterOptions}, "html/feeds/edit.html", nil
+}
 
-	if f.Id == 0 {
-		err := d.
-			QueryRowContext(context.Background(), `
-				INSERT INTO feeds 
-					(url, is_hidden, title, description, link) VALUES 
-					($1, $2, $3, $4, $5)
-				RETURNING id`, f.URL, f.IsHidden, f.Title, f.Description, f.Link).
-			Scan(&f.Id)
-		if err != nil {
-			return err
+// fetchError is returned by update when the feed could not be fetched or
+// read, as opposed to failing to save it.
+type fetchError struct {
+	err error
+}
+
+func (e *fetchError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fetchError) Unwrap() error {
+	return e.err
+}
+
+// update fetches the feed and saves it along with its new entries. Feeds are
+// shared by URL, f.Id being set to the one of the feed with that URL, which is
+// created when there is none yet. It returns the number of new entries.
+func (f *Feed) update(d *sql.DB) (int64, error) {
+	fetch := FeedFetch{StartedAt: time.Now()}
+	err := f.save(d, &fetch)
+	fetch.Duration = time.Since(fetch.StartedAt)
+	feedFetchDuration.observe(fetch.Duration.Seconds())
+	if err != nil {
+		fetch.Error = err.Error()
+		var fetchErr *fetchError
+		if errors.As(err, &fetchErr) {
+			feedFetches.add(1, "fetch_error")
+		} else {
+			feedFetches.add(1, "error")
 		}
+		slog.Warn("feed update failed", "feed_id", f.Id, "url", f.URL, "duration", fetch.Duration, "status", fetch.StatusCode, "error", err)
 	} else {
-		_, err := d.
+		feedFetches.add(1, "ok")
+		feedEntriesIngested.add(float64(fetch.ItemsInserted))
+		slog.Info("feed updated", "feed_id", f.Id, "url", f.URL, "duration", fetch.Duration, "bytes", fetch.Bytes, "new_entries", fetch.ItemsInserted)
+	}
+
+	// Feeds not saved yet have no id, and nothing to record the error on.
+	if f.Id != 0 {
+		publishFeedEvents(d, f, fetch.ItemsInserted, err)
+
+		_, err2 := d.
 			ExecContext(context.Background(), `
-				UPDATE feeds 
-				SET 
-					title=$1,
-					url=$2,link=$3,
-					description=$4,
-					is_hidden=$5
-				WHERE id=$6`, f.Title, f.URL, f.Link, f.Description, f.IsHidden, f.Id)
-		if err != nil {
-			return err
+				UPDATE feeds
+				SET
+					last_error = $2,
+					failures = CASE WHEN $2 = '' THEN 0 ELSE failures + 1 END,
+					is_disabled = $2 <> '' AND failures + 1 >= $3
+				WHERE id = $1`, f.Id, fetch.Error, feedMaxFailures)
+		if err2 == nil {
+			err2 = fetch.record(context.Background(), d, f.Id)
+		}
+		if err2 != nil {
+			return 0, errors.Join(err, err2)
 		}
 	}
 
-	_, err = d.
-		ExecContext(context.Background(), `
-			DELETE FROM feed_entries
-			WHERE 
-				feed_id = $1 AND
-				pub_date < NOW() - interval '30 days'
-			`, f.Id)
+	return fetch.ItemsInserted, err
+}
+
+// feedMaxFailures is the number of updates failing in a row after which a
+// feed is disabled. The scheduler leaves disabled feeds alone until one is
+// refreshed right away successfully.
+const feedMaxFailures = 10
+
+// save does the work of update, describing it in fetch.
+func (f *Feed) save(d *sql.DB, fetch *FeedFetch) error {
+	rss, response, err := rss.Get(f.URL)
+	fetch.StatusCode = response.StatusCode
+	fetch.Bytes = response.Bytes
+	if err != nil {
+		return &fetchError{err: err}
+	}
+
+	f.Channel = rss.Channels[0]
+	f.Format = strings.TrimSpace("RSS " + rss.Version)
+
+	err = d.
+		QueryRowContext(context.Background(), `
+			INSERT INTO feeds 
+				(url, title, description, link, format) VALUES 
+				($1, $2, $3, $4, $5)
+			ON CONFLICT (url) DO UPDATE
+			SET 
+				title=EXCLUDED.title,
+				link=EXCLUDED.link,
+				description=EXCLUDED.description,
+				format=EXCLUDED.format,
+				updated_at=NOW()
+			RETURNING id`, f.URL, f.Title, f.Description, f.Link, f.Format).
+		Scan(&f.Id)
 	if err != nil {
 		return err
 	}
 
+	fetch.ItemsSeen = len(rss.Channels[0].Items)
 	for _, item := range rss.Channels[0].Items {
 		feedEntry := FeedEntry{
 			FeedId: f.Id,
 			Item:   item,
 		}
 
-		_, err = d.
+		result, err := d.
 			ExecContext(context.Background(), `
 				INSERT INTO feed_entries
-					(feed_id, title, description, content, link, pub_date) 
-					VALUES ($1, $2, $3, $4, $5, $6)
+					(feed_id, title, description, content, link, pub_date, enclosure_url, enclosure_type, enclosure_length) 
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 					ON CONFLICT ON CONSTRAINT feed_id_link_key DO NOTHING
-					`, feedEntry.FeedId, feedEntry.Title, feedEntry.Description, feedEntry.Content, feedEntry.Link, feedEntry.PubDate.Time)
+					`, feedEntry.FeedId, feedEntry.Title, feedEntry.Description, feedEntry.Content, feedEntry.Link, feedEntry.PubDate.Time, feedEntry.Enclosure.URL, feedEntry.Enclosure.Type, feedEntry.Enclosure.Length)
+		if err != nil {
+			return err
+		}
+		inserted, err := result.RowsAffected()
 		if err != nil {
 			return err
 		}
+		fetch.ItemsInserted += inserted
 	}
 
 	return nil
 }
 
+// add sets f.Id to the feed with the URL of f, creating it when there is none
+// yet. New feeds are titled by their URL until the scheduler fetches them, which
+// notifyFeedsDue has it do right away.
+func (f *Feed) add(ctx context.Context, d *sql.DB) error {
+	f.URL = strings.TrimSpace(f.URL)
+	u, err := url.Parse(f.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return badRequest(fmt.Errorf("%q is not an http or https URL", f.URL))
+	}
+
+	return d.
+		QueryRowContext(ctx, `
+			INSERT INTO feeds (url, title, description, link) VALUES ($1, $1, '', '')
+			ON CONFLICT (url) DO UPDATE SET url = EXCLUDED.url
+			RETURNING id, title`, f.URL).
+		Scan(&f.Id, &f.Title)
+}
+
+// subscribe subscribes the user to the feed, updating the hidden flag and the
+// retention settings of an existing subscription.
+func (f *Feed) subscribe(ctx context.Context, d *sql.DB, userId int) error {
+	_, err := d.
+		ExecContext(ctx, `
+			INSERT INTO subscriptions
+				(user_id, feed_id, is_hidden, retention_days, retention_count, keep_forever) VALUES
+				($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (user_id, feed_id) DO UPDATE
+			SET
+				is_hidden = EXCLUDED.is_hidden,
+				retention_days = EXCLUDED.retention_days,
+				retention_count = EXCLUDED.retention_count,
+				keep_forever = EXCLUDED.keep_forever`,
+			userId, f.Id, f.IsHidden, f.RetentionDays, f.RetentionCount, f.KeepForever)
+
+	return err
+}
+
+// SetEdit subscribes to the feed at the URL form value, which the scheduler
+// fetches when it is new. Editing the URL of a subscription moves it over to
+// the feed at the new URL.
 func (f *FeedsController) SetEdit(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	retentionDays, err := countFormValue(r, "RetentionDays")
+	if err != nil {
+		return nil, "", err
+	}
+	retentionCount, err := countFormValue(r, "RetentionCount")
+	if err != nil {
+		return nil, "", err
+	}
+	user := currentUser(r)
+	previous := Feed{Id: idFormValue(r)}
 	feed := Feed{
-		Id:       idFormValue(r),
-		IsHidden: r.FormValue("IsHidden") == "on",
-		URL:      r.FormValue("URL"),
+		IsHidden:       r.FormValue("IsHidden") == "on",
+		URL:            r.FormValue("URL"),
+		RetentionDays:  retentionDays,
+		RetentionCount: retentionCount,
+		KeepForever:    r.FormValue("KeepForever") == "on",
+	}
+	err = feed.add(r.Context(), d)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = feed.subscribe(r.Context(), d, user.Id)
+	if err != nil {
+		return nil, "", err
+	}
+	notifyFeedsDue(r.Context(), d)
+
+	if previous.Id != 0 && previous.Id != feed.Id {
+		err = previous.unsubscribe(r.Context(), d, user.Id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, "", err
+		}
 	}
-	err := feed.update(d)
+
+	err = feed.setFolder(r.Context(), d, user.Id, r.FormValue("Folder"))
 	if err != nil {
 		return nil, "", err
 	}
@@ -160,9 +410,59 @@ func (f *FeedsController) SetEdit(d *sql.DB, w http.ResponseWriter, r *http.Requ
 	return Index(d, w, r)
 }
 
+// unsubscribe removes the subscription of the user to the feed, failing with
+// sql.ErrNoRows when there is none. Feeds left without subscribers are deleted
+// along with their entries.
+func (f *Feed) unsubscribe(ctx context.Context, d *sql.DB, userId int) error {
+	result, err := d.ExecContext(ctx, "DELETE FROM subscriptions WHERE user_id = $1 AND feed_id = $2", userId, f.Id)
+	if err != nil {
+		return err
+	}
+
+	err = rowAffected(result)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.
+		ExecContext(ctx, `
+			DELETE FROM feeds
+			WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM subscriptions WHERE feed_id = $1)`, f.Id)
+	if err != nil {
+		return err
+	}
+
+	return pruneFolders(ctx, d, userId)
+}
+
+// GetDelete asks to confirm unsubscribing from the feed.
+func (f *FeedsController) GetDelete(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	var title string
+	err := d.
+		QueryRowContext(r.Context(), `
+			SELECT feeds.title
+			FROM feeds, subscriptions
+			WHERE
+				subscriptions.feed_id = feeds.id AND
+				feeds.id = $1 AND
+				subscriptions.user_id = $2`, idPathValue(r), currentUser(r).Id).
+		Scan(&title)
+	if err != nil {
+		return nil, "", err
+	}
+
+	confirmation := Confirmation{
+		Question: "Delete the feed " + title + " and its entries?",
+		Action:   "/feeds/delete/" + strconv.Itoa(idPathValue(r)),
+		Cancel:   "/feeds/list",
+	}
+
+	return &Response{Data: confirmation}, "html/delete.html", nil
+}
+
 func (f *FeedsController) Delete(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
-	_, err := d.
-		ExecContext(r.Context(), "DELETE FROM feeds WHERE id = $1", r.PathValue("Id"))
+	feed := Feed{Id: idPathValue(r)}
+	err := feed.unsubscribe(r.Context(), d, currentUser(r).Id)
 	if err != nil {
 		return nil, "", err
 	}
@@ -170,30 +470,112 @@ func (f *FeedsController) Delete(d *sql.DB, w http.ResponseWriter, r *http.Reque
 	return Index(d, w, r)
 }
 
-func (f *FeedsController) List(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
-	rows, err := d.
-		QueryContext(r.Context(), "SELECT id, title from feeds")
+// Refresh updates the feed right away and shows the outcome on the feeds.
+func (f *FeedsController) Refresh(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	feed, newEntries, err := refreshFeed(r.Context(), d, currentUser(r).Id, idPathValue(r), f.refreshInterval)
+	notice, err := refreshNotice(feed, newEntries, err)
 	if err != nil {
 		return nil, "", err
 	}
 
+	response, templateName, err := f.List(d, w, r)
+	if response != nil {
+		response.Notice = notice
+	}
+
+	return response, templateName, err
+}
+
+// RefreshAll has the scheduler update every feed of the user right away.
+func (f *FeedsController) RefreshAll(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	queued, err := queueRefresh(r.Context(), d, currentUser(r).Id, nil, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	response, templateName, err := f.List(d, w, r)
+	if response != nil {
+		response.Notice = fmt.Sprintf("Refreshing %d feeds", queued)
+	}
+
+	return response, templateName, err
+}
+
+// listFeeds returns every feed the user is subscribed to with its folder and
+// number of unread entries, ordered by folder, the feeds outside of any folder
+// coming first.
+func listFeeds(ctx context.Context, d *sql.DB, userId int) ([]Feed, error) {
+	rows, err := d.
+		QueryContext(ctx, `
+			SELECT
+				feeds.id,
+				feeds.url,
+				feeds.title,
+				feeds.link,
+				feeds.description,
+				subscriptions.is_hidden,
+				subscriptions.retention_days,
+				subscriptions.retention_count,
+				subscriptions.keep_forever,
+				COALESCE(folders.id, 0),
+				COALESCE(folders.name, ''),
+				feeds.last_error,
+				feeds.is_updating,
+				feeds.is_disabled,
+				COUNT(feed_entries.id) FILTER (WHERE NOT `+entryState("is_read", "$1")+`)
+			FROM feeds
+			JOIN subscriptions ON subscriptions.feed_id = feeds.id AND subscriptions.user_id = $1
+			LEFT JOIN feed_entries ON feed_entries.feed_id = feeds.id
+			LEFT JOIN folders ON folders.id = subscriptions.folder_id
+			GROUP BY
+				feeds.id,
+				subscriptions.is_hidden,
+				subscriptions.retention_days,
+				subscriptions.retention_count,
+				subscriptions.keep_forever,
+				folders.id
+			ORDER BY folders.name NULLS FIRST, feeds.id`, userId)
+	if err != nil {
+		return nil, err
+	}
+
 	var feeds []Feed
 	for {
 		hasRow := rows.Next()
 		if rows.Err() != nil {
-			return nil, "", rows.Err()
+			return nil, rows.Err()
 		}
 		if !hasRow {
 			break
 		}
 
 		var feed Feed
-		err := rows.Scan(&feed.Id, &feed.Title)
+		err := rows.Scan(&feed.Id, &feed.URL, &feed.Title, &feed.Link, &feed.Description, &feed.IsHidden, &feed.RetentionDays, &feed.RetentionCount, &feed.KeepForever, &feed.FolderId, &feed.Folder, &feed.LastError, &feed.IsUpdating, &feed.IsDisabled, &feed.UnreadCount)
 		if err != nil {
-			return nil, "", err
+			return nil, err
 		}
 		feeds = append(feeds, feed)
 	}
 
-	return &Response{Data: feeds}, "html/feeds/list.html", nil
+	return feeds, nil
+}
+
+// List renders the feeds grouped by folder.
+func (f *FeedsController) List(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	feeds, err := listFeeds(r.Context(), d, currentUser(r).Id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var folders []Folder
+	for _, feed := range feeds {
+		if len(folders) == 0 || folders[len(folders)-1].Id != feed.FolderId {
+			folders = append(folders, Folder{Id: feed.FolderId, Name: feed.Folder})
+		}
+		folder := &folders[len(folders)-1]
+		folder.Feeds = append(folder.Feeds, feed)
+		folder.UnreadCount += feed.UnreadCount
+	}
+
+	return &Response{Data: folders}, "html/feeds/list.html", nil
 }
@@ -1,28 +1,193 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"html/template"
 	"net/http"
 	"rss-app/rss"
+	"strings"
+	"time"
 )
 
 type FeedEntry struct {
-	Id     int
-	FeedId int
+	Id        int
+	FeedId    int
+	IsRead    bool
+	IsStarred bool
+	// Snippet holds the search match highlights when listed by a query.
+	Snippet template.HTML
 	rss.Item
 }
 
-type FeedEntriesController struct{}
+type FeedEntriesController struct {
+	// refreshInterval is the time until the next update of a refreshed feed.
+	refreshInterval time.Duration
+}
+
+// load reads the entry with the id of e, failing with sql.ErrNoRows when the
+// user is not subscribed to its feed.
+func (e *FeedEntry) load(ctx context.Context, d *sql.DB, userId int) error {
+	return d.QueryRowContext(ctx, `
+	SELECT feed_id, title, link, description, content, pub_date, `+entryState("is_read", "$2")+`, `+entryState("is_starred", "$2")+`, enclosure_url, enclosure_type, enclosure_length
+	FROM feed_entries
+	WHERE id = $1 AND `+subscribed("$2", true), e.Id, userId).Scan(&e.FeedId, &e.Title, &e.Link, &e.Description, &e.Content, &e.PubDate.Time, &e.IsRead, &e.IsStarred, &e.Enclosure.URL, &e.Enclosure.Type, &e.Enclosure.Length)
+}
+
+// markEntries sets the is_read or is_starred column of the user state of the
+// entries matching conditions on feed_entries and feeds, among the ones of the
+// feeds the user is subscribed to.
+func markEntries(ctx context.Context, d *sql.DB, userId int, column string, value bool, conditions []string, args queryArgs) (sql.Result, error) {
+	user := args.add(userId)
+	state := args.add(value)
+	conditions = append(conditions, "feeds.id = feed_entries.feed_id", subscribed(user, true))
+
+	return d.
+		ExecContext(ctx, `
+			INSERT INTO feed_entry_states (user_id, feed_entry_id, `+column+`)
+			SELECT `+user+`::int, feed_entries.id, `+state+`::boolean
+			FROM feed_entries, feeds
+			WHERE `+strings.Join(conditions, " AND ")+`
+			ON CONFLICT (user_id, feed_entry_id) DO UPDATE SET `+column+` = EXCLUDED.`+column, args...)
+}
+
+// setRead sets the read state of the entry for the user, failing with
+// sql.ErrNoRows when it does not exist or is not in a feed of the user.
+func (e *FeedEntry) setRead(ctx context.Context, d *sql.DB, userId int, read bool) error {
+	var args queryArgs
+	conditions := []string{"feed_entries.id = " + args.add(e.Id)}
+	result, err := markEntries(ctx, d, userId, "is_read", read, conditions, args)
+	if err != nil {
+		return err
+	}
+
+	e.IsRead = read
+
+	return rowAffected(result)
+}
+
+// setStarred sets the starred state of the entry for the user, failing with
+// sql.ErrNoRows when it does not exist or is not in a feed of the user.
+func (e *FeedEntry) setStarred(ctx context.Context, d *sql.DB, userId int, starred bool) error {
+	var args queryArgs
+	conditions := []string{"feed_entries.id = " + args.add(e.Id)}
+	result, err := markEntries(ctx, d, userId, "is_starred", starred, conditions, args)
+	if err != nil {
+		return err
+	}
+
+	e.IsStarred = starred
+
+	return rowAffected(result)
+}
 
 func (f *FeedEntriesController) Show(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
 	feedEntry := FeedEntry{Id: idPathValue(r)}
-	err := d.QueryRowContext(r.Context(), `
-	SELECT title, link, description, content, pub_date 
-	FROM feed_entries
-	WHERE id = $1`, feedEntry.Id).Scan(&feedEntry.Title, &feedEntry.Link, &feedEntry.Description, &feedEntry.Content, &feedEntry.PubDate.Time)
+	err := feedEntry.setRead(r.Context(), d, currentUser(r).Id, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = feedEntry.load(r.Context(), d, currentUser(r).Id)
 	if err != nil {
 		return nil, "", err
 	}
 
 	return &Response{Data: feedEntry}, "html/feed_entries/show.html", nil
 }
+
+func (f *FeedEntriesController) SetRead(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	feedEntry := FeedEntry{Id: idPathValue(r)}
+	err := feedEntry.setRead(r.Context(), d, currentUser(r).Id, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return Index(d, w, r)
+}
+
+func (f *FeedEntriesController) SetUnread(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	feedEntry := FeedEntry{Id: idPathValue(r)}
+	err := feedEntry.setRead(r.Context(), d, currentUser(r).Id, false)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return Index(d, w, r)
+}
+
+// SetAllRead marks every entry matching the current filter and published on
+// or before the Before date as read.
+func (f *FeedEntriesController) SetAllRead(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	before, err := time.Parse(time.DateOnly, r.FormValue("Before"))
+	if err != nil {
+		before = time.Now()
+	} else {
+		before = before.AddDate(0, 0, 1)
+	}
+
+	filter := parseFeedEntryFilter(r.Form)
+	filter.userId = currentUser(r).Id
+
+	var args queryArgs
+	conditions := filter.where(&args)
+	conditions = append(conditions, "feed_entries.pub_date < "+args.add(before))
+	_, err = markEntries(r.Context(), d, filter.userId, "is_read", true, conditions, args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return Index(d, w, r)
+}
+
+// Refresh updates the feed the entries are filtered by right away, or has the
+// scheduler update the feeds of the user when there is not a single one, only
+// the ones of the folder filtered by if any.
+func (f *FeedEntriesController) Refresh(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	filter := parseFeedEntryFilter(r.Form)
+	user := currentUser(r)
+
+	var notice string
+	if len(filter.FeedIds) == 1 {
+		feed, newEntries, err := refreshFeed(r.Context(), d, user.Id, filter.FeedIds[0], f.refreshInterval)
+		notice, err = refreshNotice(feed, newEntries, err)
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		queued, err := queueRefresh(r.Context(), d, user.Id, filter.FeedIds, filter.FolderId)
+		if err != nil {
+			return nil, "", err
+		}
+		notice = fmt.Sprintf("Refreshing %d feeds, reload to see their new entries", queued)
+	}
+
+	response, templateName, err := Index(d, w, r)
+	if response != nil {
+		response.Notice = notice
+	}
+
+	return response, templateName, err
+}
+
+func (f *FeedEntriesController) ToggleStarred(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	feedEntry := FeedEntry{Id: idPathValue(r)}
+	err := feedEntry.load(r.Context(), d, currentUser(r).Id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = feedEntry.setStarred(r.Context(), d, currentUser(r).Id, !feedEntry.IsStarred)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return f.Show(d, w, r)
+}
+
+func (f *FeedEntriesController) Starred(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	r.Form.Set("StarredOnly", "on")
+
+	return Index(d, w, r)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// feedFetchesKept is the number of fetches kept in the history of each feed.
+const feedFetchesKept = 100
+
+// FeedFetch is an attempt at updating a feed, as recorded in feed_fetches.
+type FeedFetch struct {
+	StartedAt time.Time
+	Duration  time.Duration
+	// StatusCode is 0 when no response was received.
+	StatusCode    int
+	Bytes         int64
+	ItemsSeen     int
+	ItemsInserted int64
+	// Error is empty when the fetch succeeded.
+	Error string
+}
+
+// record adds the fetch to the history of the feed.
+func (f *FeedFetch) record(ctx context.Context, d *sql.DB, feedId int) error {
+	_, err := d.
+		ExecContext(ctx, `
+			INSERT INTO feed_fetches
+				(feed_id, started_at, duration_ms, status_code, bytes, items_seen, items_inserted, error)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			feedId, f.StartedAt, f.Duration.Milliseconds(), f.StatusCode, f.Bytes, f.ItemsSeen, f.ItemsInserted, f.Error)
+
+	return err
+}
+
+// listFeedFetches returns the last fetches of the feed, the latest first.
+func listFeedFetches(ctx context.Context, d *sql.DB, feedId int, limit int) ([]FeedFetch, error) {
+	rows, err := d.
+		QueryContext(ctx, `
+			SELECT started_at, duration_ms, status_code, bytes, items_seen, items_inserted, error
+			FROM feed_fetches
+			WHERE feed_id = $1
+			ORDER BY started_at DESC, id DESC
+			LIMIT $2`, feedId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fetches []FeedFetch
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return nil, rows.Err()
+			}
+			break
+		}
+
+		var fetch FeedFetch
+		var durationMs int64
+		err := rows.Scan(&fetch.StartedAt, &durationMs, &fetch.StatusCode, &fetch.Bytes, &fetch.ItemsSeen, &fetch.ItemsInserted, &fetch.Error)
+		if err != nil {
+			return nil, err
+		}
+		fetch.Duration = time.Duration(durationMs) * time.Millisecond
+		fetches = append(fetches, fetch)
+	}
+
+	return fetches, nil
+}
+
+// pruneFeedFetches deletes the fetches beyond the last feedFetchesKept of each
+// feed and returns how many.
+func pruneFeedFetches(ctx context.Context, d *sql.DB) (int64, error) {
+	result, err := d.
+		ExecContext(ctx, `
+			DELETE FROM feed_fetches
+			WHERE id IN (
+				SELECT id
+				FROM (
+					SELECT
+						id,
+						ROW_NUMBER() OVER (
+							PARTITION BY feed_id
+							ORDER BY started_at DESC, id DESC
+						) AS position
+					FROM feed_fetches
+				) AS ranked
+				WHERE position > $1
+			)`, feedFetchesKept)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// feverPageSize is the number of items the Fever API returns at once.
+const feverPageSize = 50
+
+type feverGroup struct {
+	Id    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type feverFeedsGroup struct {
+	GroupId int    `json:"group_id"`
+	FeedIds string `json:"feed_ids"`
+}
+
+type feverFeed struct {
+	Id                int    `json:"id"`
+	FaviconId         int    `json:"favicon_id"`
+	Title             string `json:"title"`
+	URL               string `json:"url"`
+	SiteURL           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+type feverFavicon struct {
+	Id   int    `json:"id"`
+	Data string `json:"data"`
+}
+
+type feverItem struct {
+	Id            int    `json:"id"`
+	FeedId        int    `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	HTML          string `json:"html"`
+	URL           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+// FeverController implements the Fever API used by mobile clients such as
+// Reeder. Fever groups are folders and every feed shares the app favicon.
+// Clients sign in as a user with the MD5 of "username:password" as API key.
+type FeverController struct{}
+
+func (f *FeverController) Handle(d *sql.DB, w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{
+		"api_version": 3,
+		"auth":        0,
+	}
+
+	user, err := feverUser(r.Context(), d, strings.ToLower(r.FormValue("api_key")))
+	if err == nil {
+		response["auth"] = 1
+		err = f.respond(r.Context(), d, user, r.Form, response)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// respond fills response with the sections asked for by form, after applying
+// the mark action if there is one.
+func (f *FeverController) respond(ctx context.Context, d *sql.DB, user *User, form url.Values, response map[string]interface{}) error {
+	if form.Has("mark") {
+		err := f.mark(ctx, d, user, form)
+		if err != nil {
+			return err
+		}
+	}
+
+	var lastRefreshed int64
+	err := d.
+		QueryRowContext(ctx, `
+			SELECT COALESCE(EXTRACT(EPOCH FROM MAX(feeds.updated_at))::bigint, 0)
+			FROM feeds, subscriptions
+			WHERE subscriptions.feed_id = feeds.id AND subscriptions.user_id = $1`, user.Id).
+		Scan(&lastRefreshed)
+	if err != nil {
+		return err
+	}
+	response["last_refreshed_on_time"] = lastRefreshed
+
+	if form.Has("groups") || form.Has("feeds") {
+		feedsGroups, err := f.feedsGroups(ctx, d, user.Id)
+		if err != nil {
+			return err
+		}
+		response["feeds_groups"] = feedsGroups
+	}
+
+	if form.Has("groups") {
+		folders, err := folders(ctx, d, user.Id)
+		if err != nil {
+			return err
+		}
+
+		groups := []feverGroup{}
+		for _, folder := range folders {
+			groups = append(groups, feverGroup{Id: folder.Id, Title: folder.Name})
+		}
+		response["groups"] = groups
+	}
+
+	if form.Has("feeds") {
+		feeds, err := f.feeds(ctx, d, user.Id)
+		if err != nil {
+			return err
+		}
+		response["feeds"] = feeds
+	}
+
+	if form.Has("favicons") {
+		favicon, err := os.ReadFile("static/favicon.svg")
+		if err != nil {
+			return err
+		}
+		response["favicons"] = []feverFavicon{{
+			Id:   1,
+			Data: "image/svg+xml;base64," + base64.StdEncoding.EncodeToString(favicon),
+		}}
+	}
+
+	if form.Has("items") {
+		items, err := f.items(ctx, d, user.Id, form)
+		if err != nil {
+			return err
+		}
+		response["items"] = items
+
+		var total int
+		err = d.
+			QueryRowContext(ctx, "SELECT COUNT(*) FROM feed_entries WHERE "+subscribed("$1", true), user.Id).
+			Scan(&total)
+		if err != nil {
+			return err
+		}
+		response["total_items"] = total
+	}
+
+	if form.Has("links") {
+		response["links"] = []struct{}{}
+	}
+
+	if form.Has("unread_item_ids") || form.Get("as") == "read" || form.Get("as") == "unread" {
+		ids, err := f.itemIds(ctx, d, user.Id, "NOT "+entryState("is_read", "$1"))
+		if err != nil {
+			return err
+		}
+		response["unread_item_ids"] = ids
+	}
+
+	if form.Has("saved_item_ids") || form.Get("as") == "saved" || form.Get("as") == "unsaved" {
+		ids, err := f.itemIds(ctx, d, user.Id, entryState("is_starred", "$1"))
+		if err != nil {
+			return err
+		}
+		response["saved_item_ids"] = ids
+	}
+
+	return nil
+}
+
+func (f *FeverController) feedsGroups(ctx context.Context, d *sql.DB, userId int) ([]feverFeedsGroup, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT folder_id, string_agg(feed_id::text, ',' ORDER BY feed_id)
+		FROM subscriptions
+		WHERE user_id = $1 AND folder_id IS NOT NULL
+		GROUP BY folder_id
+		ORDER BY folder_id`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	feedsGroups := []feverFeedsGroup{}
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return nil, rows.Err()
+			}
+			break
+		}
+
+		var feedsGroup feverFeedsGroup
+		err := rows.Scan(&feedsGroup.GroupId, &feedsGroup.FeedIds)
+		if err != nil {
+			return nil, err
+		}
+		feedsGroups = append(feedsGroups, feedsGroup)
+	}
+
+	return feedsGroups, nil
+}
+
+func (f *FeverController) feeds(ctx context.Context, d *sql.DB, userId int) ([]feverFeed, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT feeds.id, feeds.title, feeds.url, feeds.link, EXTRACT(EPOCH FROM feeds.updated_at)::bigint
+		FROM feeds, subscriptions
+		WHERE subscriptions.feed_id = feeds.id AND subscriptions.user_id = $1
+		ORDER BY feeds.id`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	feeds := []feverFeed{}
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return nil, rows.Err()
+			}
+			break
+		}
+
+		feed := feverFeed{FaviconId: 1}
+		err := rows.Scan(&feed.Id, &feed.Title, &feed.URL, &feed.SiteURL, &feed.LastUpdatedOnTime)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, feed)
+	}
+
+	return feeds, nil
+}
+
+// items returns the items after since_id, before max_id or listed in with_ids,
+// from the first one when none is given.
+func (f *FeverController) items(ctx context.Context, d *sql.DB, userId int, form url.Values) ([]feverItem, error) {
+	var args queryArgs
+	user := args.add(userId)
+	var condition string
+	order := "id ASC"
+	maxId, err := strconv.Atoi(form.Get("max_id"))
+	switch {
+	case form.Get("with_ids") != "":
+		var ids []int
+		for _, value := range strings.Split(form.Get("with_ids"), ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(value))
+			if err == nil {
+				ids = append(ids, id)
+			}
+		}
+		condition = "id = ANY(" + args.add(pq.Array(ids)) + "::int[])"
+	case err == nil && form.Get("since_id") == "":
+		condition = "id < " + args.add(maxId)
+		order = "id DESC"
+	default:
+		sinceId, _ := strconv.Atoi(form.Get("since_id"))
+		condition = "id > " + args.add(sinceId)
+	}
+
+	rows, err := d.QueryContext(ctx, `
+		SELECT
+			id,
+			feed_id,
+			title,
+			CASE WHEN content <> '' THEN content ELSE description END,
+			link,
+			`+entryState("is_starred", user)+`,
+			`+entryState("is_read", user)+`,
+			EXTRACT(EPOCH FROM pub_date)::bigint
+		FROM feed_entries
+		WHERE `+subscribed(user, true)+` AND `+condition+`
+		ORDER BY `+order+`
+		LIMIT `+strconv.Itoa(feverPageSize), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []feverItem{}
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return nil, rows.Err()
+			}
+			break
+		}
+
+		var item feverItem
+		var isSaved, isRead bool
+		err := rows.Scan(&item.Id, &item.FeedId, &item.Title, &item.HTML, &item.URL, &isSaved, &isRead, &item.CreatedOnTime)
+		if err != nil {
+			return nil, err
+		}
+		if isSaved {
+			item.IsSaved = 1
+		}
+		if isRead {
+			item.IsRead = 1
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// itemIds returns the comma separated ids of the entries of the user matching
+// condition, in which the user id is $1.
+func (f *FeverController) itemIds(ctx context.Context, d *sql.DB, userId int, condition string) (string, error) {
+	var ids string
+	err := d.
+		QueryRowContext(ctx, `
+			SELECT COALESCE(string_agg(id::text, ',' ORDER BY id), '')
+			FROM feed_entries
+			WHERE `+subscribed("$1", true)+` AND `+condition, userId).
+		Scan(&ids)
+
+	return ids, err
+}
+
+// mark applies a mark action: single items can be marked read, unread, saved
+// or unsaved and whole feeds or groups read up to the before time. Group 0 is
+// every feed.
+func (f *FeverController) mark(ctx context.Context, d *sql.DB, user *User, form url.Values) error {
+	id, err := strconv.Atoi(form.Get("id"))
+	if err != nil {
+		return nil
+	}
+	before, err := strconv.ParseInt(form.Get("before"), 10, 64)
+	if err != nil {
+		before = 0
+	}
+
+	switch form.Get("mark") {
+	case "item":
+		feedEntry := FeedEntry{Id: id}
+		switch form.Get("as") {
+		case "read":
+			err = feedEntry.setRead(ctx, d, user.Id, true)
+		case "unread":
+			err = feedEntry.setRead(ctx, d, user.Id, false)
+		case "saved":
+			err = feedEntry.setStarred(ctx, d, user.Id, true)
+		case "unsaved":
+			err = feedEntry.setStarred(ctx, d, user.Id, false)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	case "feed":
+		if form.Get("as") != "read" {
+			return nil
+		}
+		var args queryArgs
+		conditions := []string{
+			"feed_entries.feed_id = " + args.add(id),
+			"feed_entries.pub_date < to_timestamp(" + args.add(before) + ")",
+		}
+		_, err = markEntries(ctx, d, user.Id, "is_read", true, conditions, args)
+		return err
+	case "group":
+		if form.Get("as") != "read" {
+			return nil
+		}
+		var args queryArgs
+		conditions := []string{"feed_entries.pub_date < to_timestamp(" + args.add(before) + ")"}
+		if id != 0 {
+			conditions = append(conditions, "feed_entries.feed_id IN (SELECT feed_id FROM subscriptions WHERE user_id = "+args.add(user.Id)+" AND folder_id = "+args.add(id)+")")
+		}
+		_, err = markEntries(ctx, d, user.Id, "is_read", true, conditions, args)
+		return err
+	}
+
+	return nil
+}
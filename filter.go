@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"html"
+	"html/template"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// snippetStart and snippetStop surround the matches in the snippets made by
+// ts_headline. They are private use characters so that the snippet can be
+// escaped before they are turned into marks.
+const (
+	snippetStart = "\uE000"
+	snippetStop  = "\uE001"
+)
+
+// highlightSnippet returns the snippet made by ts_headline as HTML, the text
+// of the entry escaped and the matches marked. The tags of the entry are
+// already stripped, its entities are decoded before escaping.
+func highlightSnippet(snippet string) template.HTML {
+	escaped := template.HTMLEscapeString(html.UnescapeString(snippet))
+	escaped = strings.ReplaceAll(escaped, snippetStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, snippetStop, "</mark>")
+
+	return template.HTML(escaped)
+}
+
+// FeedEntryFilter is the set of conditions the entry list can be narrowed by.
+// From and To are inclusive dates in time.DateOnly form, Days limits the list
+// to the last number of days. Older and Newer are page cursors, at most one of
+// them is used.
+type FeedEntryFilter struct {
+	FeedIds       []int
+	FolderId      int
+	UnreadOnly    bool
+	StarredOnly   bool
+	HasEnclosure  bool
+	IncludeHidden bool
+	Query         string
+	Title         string
+	NotTitle      string
+	From          string
+	To            string
+	Days          int
+	PageSize      int
+	Older         string
+	Newer         string
+	// withContent loads the entry contents along with the page, which the
+	// list pages have no use for.
+	withContent bool
+	// userId is the user whose subscriptions and entry states are filtered.
+	// It is not part of the form values and is set by the callers.
+	userId int
+}
+
+// parseFeedEntryFilter reads a filter from form values, dropping the ones that
+// are not valid.
+func parseFeedEntryFilter(values url.Values) FeedEntryFilter {
+	pageSize, err := strconv.Atoi(values.Get("PageSize"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+
+	days, err := strconv.Atoi(values.Get("Days"))
+	if err != nil || days < 0 {
+		days = 0
+	}
+
+	var feedIds []int
+	for _, value := range values["FeedId"] {
+		id, err := strconv.Atoi(value)
+		if err == nil && id != 0 && !slices.Contains(feedIds, id) {
+			feedIds = append(feedIds, id)
+		}
+	}
+
+	folderId, err := strconv.Atoi(values.Get("FolderId"))
+	if err != nil {
+		folderId = 0
+	}
+
+	return FeedEntryFilter{
+		FeedIds:       feedIds,
+		FolderId:      folderId,
+		UnreadOnly:    values.Get("UnreadOnly") == "on",
+		StarredOnly:   values.Get("StarredOnly") == "on",
+		HasEnclosure:  values.Get("HasEnclosure") == "on",
+		IncludeHidden: values.Get("IncludeHidden") == "on",
+		Query:         strings.TrimSpace(values.Get("Q")),
+		Title:         strings.TrimSpace(values.Get("Title")),
+		NotTitle:      strings.TrimSpace(values.Get("NotTitle")),
+		From:          dateValue(values, "From"),
+		To:            dateValue(values, "To"),
+		Days:          days,
+		PageSize:      min(pageSize, maxPageSize),
+		Older:         values.Get("Older"),
+		Newer:         values.Get("Newer"),
+	}
+}
+
+// dateValue returns the key value when it is a time.DateOnly date.
+func dateValue(values url.Values, key string) string {
+	_, err := time.Parse(time.DateOnly, values.Get(key))
+	if err != nil {
+		return ""
+	}
+
+	return values.Get(key)
+}
+
+// Values returns the filter as form values, without the page cursors, so it
+// can be carried over in links and forms.
+func (f FeedEntryFilter) Values() url.Values {
+	values := url.Values{}
+	for _, id := range f.FeedIds {
+		values.Add("FeedId", strconv.Itoa(id))
+	}
+	if f.FolderId != 0 {
+		values.Set("FolderId", strconv.Itoa(f.FolderId))
+	}
+	flags := []struct {
+		name string
+		set  bool
+	}{
+		{"UnreadOnly", f.UnreadOnly},
+		{"StarredOnly", f.StarredOnly},
+		{"HasEnclosure", f.HasEnclosure},
+		{"IncludeHidden", f.IncludeHidden},
+	}
+	for _, flag := range flags {
+		if flag.set {
+			values.Set(flag.name, "on")
+		}
+	}
+	texts := []struct {
+		name  string
+		value string
+	}{
+		{"Q", f.Query},
+		{"Title", f.Title},
+		{"NotTitle", f.NotTitle},
+		{"From", f.From},
+		{"To", f.To},
+	}
+	for _, text := range texts {
+		if text.value != "" {
+			values.Set(text.name, text.value)
+		}
+	}
+	if f.Days != 0 {
+		values.Set("Days", strconv.Itoa(f.Days))
+	}
+	if f.PageSize != 0 && f.PageSize != defaultPageSize {
+		values.Set("PageSize", strconv.Itoa(f.PageSize))
+	}
+
+	return values
+}
+
+// HasFeed reports whether the filter is limited to, among others, feed id.
+func (f FeedEntryFilter) HasFeed(id int) bool {
+	return slices.Contains(f.FeedIds, id)
+}
+
+// queryArgs collects the arguments of a query built at runtime.
+type queryArgs []any
+
+// add appends value and returns its placeholder.
+func (a *queryArgs) add(value any) string {
+	*a = append(*a, value)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// subscribed returns the condition selecting the entries of the feeds the user
+// placeholder is subscribed to, leaving out the hidden ones unless withHidden.
+func subscribed(user string, withHidden bool) string {
+	hidden := ""
+	if !withHidden {
+		hidden = " AND subscriptions.is_hidden = false"
+	}
+
+	return "feed_entries.feed_id IN (SELECT subscriptions.feed_id FROM subscriptions WHERE subscriptions.user_id = " + user + hidden + ")"
+}
+
+// entryState returns the is_read or is_starred column of feed_entries for the
+// user placeholder. Entries without a state are neither read nor starred.
+func entryState(column string, user string) string {
+	return `COALESCE((
+		SELECT feed_entry_states.` + column + `
+		FROM feed_entry_states
+		WHERE feed_entry_states.feed_entry_id = feed_entries.id AND feed_entry_states.user_id = ` + user + `), false)`
+}
+
+// where returns the conditions selecting the entries matching the filter from
+// feed_entries joined with feeds. Page cursors are not taken into account.
+func (f FeedEntryFilter) where(args *queryArgs) []string {
+	user := args.add(f.userId)
+	withHidden := len(f.FeedIds) > 0 || f.IncludeHidden || f.StarredOnly || f.FolderId != 0
+	conditions := []string{"feeds.id = feed_entries.feed_id", subscribed(user, withHidden)}
+	if len(f.FeedIds) > 0 {
+		conditions = append(conditions, "feed_entries.feed_id = ANY("+args.add(pq.Array(f.FeedIds))+"::int[])")
+	}
+	if f.FolderId != 0 {
+		conditions = append(conditions, "feed_entries.feed_id IN (SELECT feed_id FROM subscriptions WHERE user_id = "+user+" AND folder_id = "+args.add(f.FolderId)+")")
+	}
+	if f.UnreadOnly {
+		conditions = append(conditions, "NOT "+entryState("is_read", user))
+	}
+	if f.StarredOnly {
+		conditions = append(conditions, entryState("is_starred", user))
+	}
+	if f.HasEnclosure {
+		conditions = append(conditions, "feed_entries.enclosure_url <> ''")
+	}
+	if f.Query != "" {
+		conditions = append(conditions, "feed_entries.search @@ websearch_to_tsquery('english', "+args.add(f.Query)+")")
+	}
+	if f.Title != "" {
+		conditions = append(conditions, "strpos(lower(feed_entries.title), lower("+args.add(f.Title)+")) > 0")
+	}
+	if f.NotTitle != "" {
+		conditions = append(conditions, "strpos(lower(feed_entries.title), lower("+args.add(f.NotTitle)+")) = 0")
+	}
+	if f.From != "" {
+		conditions = append(conditions, "feed_entries.pub_date >= "+args.add(f.From)+"::date")
+	}
+	if f.To != "" {
+		conditions = append(conditions, "feed_entries.pub_date < "+args.add(f.To)+"::date + 1")
+	}
+	if f.Days != 0 {
+		conditions = append(conditions, "feed_entries.pub_date >= NOW() - make_interval(days => "+args.add(f.Days)+")")
+	}
+
+	return conditions
+}
+
+// Encode returns Values in URL encoded form for use in links.
+func (f FeedEntryFilter) Encode() template.URL {
+	return template.URL(f.Values().Encode())
+}
+
+// unreadCounts returns the number of unread entries of the user matching each
+// filter, counted in a single pass over the entries.
+func unreadCounts(ctx context.Context, d *sql.DB, userId int, filters []FeedEntryFilter) ([]int, error) {
+	counts := make([]int, len(filters))
+	if len(filters) == 0 {
+		return counts, nil
+	}
+
+	var args queryArgs
+	user := args.add(userId)
+	var columns []string
+	for _, filter := range filters {
+		filter.userId = userId
+		columns = append(columns, "COUNT(*) FILTER (WHERE "+strings.Join(filter.where(&args), " AND ")+")")
+	}
+
+	targets := make([]any, len(counts))
+	for i := range counts {
+		targets[i] = &counts[i]
+	}
+	err := d.
+		QueryRowContext(ctx, `
+			SELECT `+strings.Join(columns, ", ")+`
+			FROM feed_entries, feeds
+			WHERE
+				feeds.id = feed_entries.feed_id AND
+				`+subscribed(user, true)+` AND
+				NOT `+entryState("is_read", user), args...).
+		Scan(targets...)
+
+	return counts, err
+}
+
+// FeedEntryPage is one page of a filtered entry list. Older and Newer are the
+// cursors of the neighbouring pages, empty when there is none.
+type FeedEntryPage struct {
+	Entries []FeedEntry
+	Older   string
+	Newer   string
+}
+
+// cursor is the position of an entry in the list order. Rank is only set when
+// the list is ordered by search relevance.
+type cursor struct {
+	Rank    float32
+	PubDate time.Time
+	Id      int
+}
+
+func (c cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(
+		strconv.FormatInt(c.PubDate.UnixMicro(), 10) + "," +
+			strconv.Itoa(c.Id) + "," +
+			strconv.FormatFloat(float64(c.Rank), 'g', -1, 32)))
+}
+
+// errMalformedCursor is returned by parseCursor for cursors not made by
+// cursor.String.
+var errMalformedCursor = badRequest(errors.New("malformed page cursor"))
+
+func parseCursor(s string) (cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, errMalformedCursor
+	}
+
+	parts := strings.Split(string(decoded), ",")
+	if len(parts) != 3 {
+		return cursor{}, errMalformedCursor
+	}
+
+	pubDate, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return cursor{}, errMalformedCursor
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return cursor{}, errMalformedCursor
+	}
+	rank, err := strconv.ParseFloat(parts[2], 32)
+	if err != nil {
+		return cursor{}, errMalformedCursor
+	}
+
+	return cursor{Rank: float32(rank), PubDate: time.UnixMicro(pubDate), Id: id}, nil
+}
+
+// page returns the entries matching the filter, newest or best ranked first,
+// using keyset pagination on the list order.
+func (f FeedEntryFilter) page(ctx context.Context, d *sql.DB) (*FeedEntryPage, error) {
+	var args queryArgs
+	conditions := f.where(&args)
+	user := args.add(f.userId)
+
+	content := "''"
+	if f.withContent {
+		content = "feed_entries.content"
+	}
+
+	rank := "0::real"
+	snippet := "''"
+	key := []string{"feed_entries.pub_date", "feed_entries.id"}
+	if f.Query != "" {
+		query := "websearch_to_tsquery('english', " + args.add(f.Query) + ")"
+		rank = "ts_rank(feed_entries.search, " + query + ")"
+		snippet = `ts_headline('english',
+			regexp_replace(feed_entries.description || ' ' || feed_entries.content, '<[^>]*>', ' ', 'g'),
+			` + query + `,
+			'StartSel=` + snippetStart + `, StopSel=` + snippetStop + `, MaxFragments=2')`
+		key = append([]string{rank}, key...)
+	}
+
+	pageSize := f.PageSize
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+
+	// Newer pages are read in ascending order and flipped afterwards so the
+	// LIMIT keeps the entries closest to the cursor.
+	var position *cursor
+	ascending := false
+	if f.Newer != "" {
+		c, err := parseCursor(f.Newer)
+		if err != nil {
+			return nil, err
+		}
+		position = &c
+		ascending = true
+	} else if f.Older != "" {
+		c, err := parseCursor(f.Older)
+		if err != nil {
+			return nil, err
+		}
+		position = &c
+	}
+
+	order := " DESC"
+	compare := " < "
+	if ascending {
+		order = " ASC"
+		compare = " > "
+	}
+	if position != nil {
+		bound := []string{args.add(position.PubDate), args.add(position.Id)}
+		if f.Query != "" {
+			bound = append([]string{args.add(position.Rank) + "::real"}, bound...)
+		}
+		conditions = append(conditions, "("+strings.Join(key, ", ")+")"+compare+"("+strings.Join(bound, ", ")+")")
+	}
+
+	limit := args.add(pageSize + 1)
+	rows, err := d.QueryContext(ctx, `
+		SELECT
+			feed_entries.id,
+			feed_entries.title,
+			feed_entries.link,
+			feed_entries.description,
+			`+content+`,
+			feed_entries.pub_date,
+			`+entryState("is_read", user)+`,
+			`+entryState("is_starred", user)+`,
+			feed_entries.enclosure_url,
+			feed_entries.enclosure_type,
+			feed_entries.enclosure_length,
+			feeds.title,
+			`+snippet+`,
+			`+rank+`
+		FROM feed_entries, feeds
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY `+strings.Join(key, order+", ")+order+`
+		LIMIT `+limit, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var feedEntries []FeedEntry
+	var cursors []cursor
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return nil, rows.Err()
+			}
+			break
+		}
+
+		var feedEntry FeedEntry
+		var c cursor
+		var snippet string
+		err := rows.Scan(&feedEntry.Id, &feedEntry.Title, &feedEntry.Link, &feedEntry.Description, &feedEntry.Content, &feedEntry.PubDate.Time, &feedEntry.IsRead, &feedEntry.IsStarred, &feedEntry.Enclosure.URL, &feedEntry.Enclosure.Type, &feedEntry.Enclosure.Length, &feedEntry.Author, &snippet, &c.Rank)
+		if err != nil {
+			return nil, err
+		}
+		feedEntry.Snippet = highlightSnippet(snippet)
+		c.PubDate = feedEntry.PubDate.Time
+		c.Id = feedEntry.Id
+		feedEntries = append(feedEntries, feedEntry)
+		cursors = append(cursors, c)
+	}
+
+	hasMore := len(feedEntries) > pageSize
+	if hasMore {
+		feedEntries = feedEntries[:pageSize]
+		cursors = cursors[:pageSize]
+	}
+	if ascending {
+		slices.Reverse(feedEntries)
+		slices.Reverse(cursors)
+	}
+
+	page := FeedEntryPage{Entries: feedEntries}
+	if len(cursors) == 0 {
+		return &page, nil
+	}
+	if (ascending && hasMore) || (!ascending && position != nil) {
+		page.Newer = cursors[0].String()
+	}
+	if ascending || hasMore {
+		page.Older = cursors[len(cursors)-1].String()
+	}
+
+	return &page, nil
+}
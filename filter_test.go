@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor cursor
+	}{
+		{"date order", cursor{PubDate: time.UnixMicro(1700000000123456), Id: 42}},
+		{"search rank", cursor{Rank: 0.0607927, PubDate: time.UnixMicro(1700000000123456), Id: 7}},
+		{"before 1970", cursor{PubDate: time.UnixMicro(-86400000000), Id: 1}},
+		{"zero", cursor{PubDate: time.UnixMicro(0)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := parseCursor(test.cursor.String())
+			if err != nil {
+				t.Fatalf("parseCursor: %v", err)
+			}
+			if parsed.Rank != test.cursor.Rank || !parsed.PubDate.Equal(test.cursor.PubDate) || parsed.Id != test.cursor.Id {
+				t.Errorf("parseCursor(%q) = %+v, want %+v", test.cursor.String(), parsed, test.cursor)
+			}
+		})
+	}
+}
+
+func TestParseCursorMalformed(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"not base64", "not base64!"},
+		{"padded base64", encode("1,2,3") + "=="},
+		{"too few parts", encode("1,2")},
+		{"too many parts", encode("1,2,3,4")},
+		{"bad date", encode("x,2,0")},
+		{"bad id", encode("1,x,0")},
+		{"bad rank", encode("1,2,x")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseCursor(test.value)
+			if err == nil {
+				t.Fatalf("parseCursor(%q) succeeded", test.value)
+			}
+			if status := errorStatus(err); status != http.StatusBadRequest {
+				t.Errorf("errorStatus = %d, want %d", status, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestFeedEntryFilterRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter FeedEntryFilter
+	}{
+		{"default", FeedEntryFilter{PageSize: defaultPageSize}},
+		{"every value", FeedEntryFilter{
+			FeedIds:       []int{3, 1},
+			FolderId:      2,
+			UnreadOnly:    true,
+			StarredOnly:   true,
+			HasEnclosure:  true,
+			IncludeHidden: true,
+			Query:         "go generics",
+			Title:         "release",
+			NotTitle:      "sponsored",
+			From:          "2024-01-02",
+			To:            "2024-02-03",
+			Days:          7,
+			PageSize:      maxPageSize,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed := parseFeedEntryFilter(test.filter.Values())
+			if !reflect.DeepEqual(parsed, test.filter) {
+				t.Errorf("parseFeedEntryFilter(%v) = %+v, want %+v", test.filter.Values(), parsed, test.filter)
+			}
+		})
+	}
+}
+
+func TestParseFeedEntryFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		values url.Values
+		want   url.Values
+	}{
+		{"empty", url.Values{}, url.Values{}},
+		{"invalid values dropped", url.Values{
+			"FeedId":   {"x", "0", "4", "4"},
+			"FolderId": {"x"},
+			"Days":     {"-1"},
+			"From":     {"yesterday"},
+			"PageSize": {"0"},
+			"Q":        {"  "},
+		}, url.Values{"FeedId": {"4"}}},
+		{"page size capped", url.Values{"PageSize": {"100000"}}, url.Values{"PageSize": {"500"}}},
+		{"cursors left out", url.Values{"Older": {"abc"}, "Newer": {"def"}, "UnreadOnly": {"on"}}, url.Values{"UnreadOnly": {"on"}}},
+		{"flags need on", url.Values{"StarredOnly": {"true"}}, url.Values{}},
+		{"text trimmed", url.Values{"Title": {" a b "}}, url.Values{"Title": {"a b"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseFeedEntryFilter(test.values).Values()
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseFeedEntryFilter(%v).Values() = %v, want %v", test.values, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Folder groups the feeds of a user on the feed list. A feed is in at most one
+// folder of each user and folders without feeds are removed.
+type Folder struct {
+	Id          int
+	Name        string
+	UnreadCount int
+	Feeds       []Feed
+}
+
+// folders returns the folders of the user.
+func folders(ctx context.Context, d *sql.DB, userId int) ([]Folder, error) {
+	rows, err := d.QueryContext(ctx, "SELECT id, name FROM folders WHERE user_id = $1 ORDER BY name", userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var folders []Folder
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return nil, rows.Err()
+			}
+			break
+		}
+
+		var folder Folder
+		err := rows.Scan(&folder.Id, &folder.Name)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+
+	return folders, nil
+}
+
+// setFolder moves the user subscription to the feed into the folder called
+// name, creating it when needed. An empty name takes the feed out of its
+// folder.
+func (f *Feed) setFolder(ctx context.Context, d *sql.DB, userId int, name string) error {
+	name = strings.TrimSpace(name)
+
+	if name != "" {
+		_, err := d.
+			ExecContext(ctx, `
+				INSERT INTO folders (user_id, name) VALUES ($1, $2)
+				ON CONFLICT (user_id, name) DO NOTHING`, userId, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := d.
+		ExecContext(ctx, `
+			UPDATE subscriptions
+			SET folder_id = (SELECT id FROM folders WHERE user_id = $1 AND name = $3)
+			WHERE user_id = $1 AND feed_id = $2`, userId, f.Id, name)
+	if err != nil {
+		return err
+	}
+
+	err = pruneFolders(ctx, d, userId)
+	if err != nil {
+		return err
+	}
+
+	f.Folder = name
+
+	return nil
+}
+
+// pruneFolders removes the folders of the user that no longer hold any feed.
+func pruneFolders(ctx context.Context, d *sql.DB, userId int) error {
+	_, err := d.
+		ExecContext(ctx, `
+			DELETE FROM folders
+			WHERE
+				user_id = $1 AND
+				NOT EXISTS (SELECT 1 FROM subscriptions WHERE subscriptions.folder_id = folders.id)`, userId)
+
+	return err
+}
@@ -2,4 +2,7 @@ module rss-app
 
 go 1.22.1
 
-require github.com/lib/pq v1.10.9
+require (
+	github.com/lib/pq v1.10.9
+	golang.org/x/crypto v0.33.0
+)
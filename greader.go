@@ -0,0 +1,642 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	greaderReadingList = "user/-/state/com.google/reading-list"
+	greaderRead        = "user/-/state/com.google/read"
+	greaderStarred     = "user/-/state/com.google/starred"
+	greaderKeptUnread  = "user/-/state/com.google/kept-unread"
+	greaderLabel       = "user/-/label/"
+	greaderItemPrefix  = "tag:google.com,2005:reader/item/"
+
+	greaderDefaultCount = 20
+	greaderMaxCount     = 10000
+
+	// greaderTokenLifetime is how long the clients stay signed in.
+	greaderTokenLifetime = 30 * 24 * time.Hour
+)
+
+type greaderCategory struct {
+	Id    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type greaderSubscription struct {
+	Id         string            `json:"id"`
+	Title      string            `json:"title"`
+	Categories []greaderCategory `json:"categories"`
+	URL        string            `json:"url"`
+	HTMLURL    string            `json:"htmlUrl"`
+	IconURL    string            `json:"iconUrl"`
+}
+
+type greaderTag struct {
+	Id   string `json:"id"`
+	Type string `json:"type,omitempty"`
+}
+
+type greaderItemRef struct {
+	Id string `json:"id"`
+}
+
+type greaderLink struct {
+	Href string `json:"href"`
+	Type string `json:"type,omitempty"`
+}
+
+type greaderContent struct {
+	Direction string `json:"direction"`
+	Content   string `json:"content"`
+}
+
+type greaderOrigin struct {
+	StreamId string `json:"streamId"`
+	Title    string `json:"title"`
+	HTMLURL  string `json:"htmlUrl"`
+}
+
+type greaderItem struct {
+	Id            string         `json:"id"`
+	CrawlTimeMsec string         `json:"crawlTimeMsec"`
+	TimestampUsec string         `json:"timestampUsec"`
+	Published     int64          `json:"published"`
+	Updated       int64          `json:"updated"`
+	Title         string         `json:"title"`
+	Canonical     []greaderLink  `json:"canonical"`
+	Alternate     []greaderLink  `json:"alternate"`
+	Summary       greaderContent `json:"summary"`
+	Categories    []string       `json:"categories"`
+	Origin        greaderOrigin  `json:"origin"`
+	Author        string         `json:"author"`
+}
+
+type greaderStream struct {
+	Id           string        `json:"id"`
+	Updated      int64         `json:"updated"`
+	Items        []greaderItem `json:"items"`
+	Continuation string        `json:"continuation,omitempty"`
+}
+
+// GReaderController implements the subset of the Google Reader API used by
+// clients such as NetNewsWire. Feeds are "feed/{Id}" streams and folders are
+// labels. Clients sign in as a user with their username and password.
+type GReaderController struct {
+	secret []byte
+}
+
+func newGReaderController(config *Config) *GReaderController {
+	greader := GReaderController{secret: []byte(config.APISecret)}
+	if len(greader.secret) == 0 {
+		greader.secret = randomKey()
+	}
+
+	return &greader
+}
+
+// Token kinds: auth tokens sign clients in, action tokens are the T form value
+// of the requests changing state.
+const (
+	greaderAuthToken   = "auth"
+	greaderActionToken = "action"
+)
+
+// sign returns the signature of a token of kind for the user, expiring at
+// expiry. Tokens are no longer valid once the secret changes.
+func (g *GReaderController) sign(kind string, userId string, expiry string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(kind + ":" + userId + ":" + expiry))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newToken returns a token of kind for the user valid for
+// greaderTokenLifetime, made of the user id, its expiry as a Unix time and its
+// signature.
+func (g *GReaderController) newToken(kind string, userId int) string {
+	id := strconv.Itoa(userId)
+	expiry := strconv.FormatInt(time.Now().Add(greaderTokenLifetime).Unix(), 10)
+
+	return id + "/" + expiry + "/" + g.sign(kind, id, expiry)
+}
+
+// tokenUser returns the id of the user of a token of kind made by newToken,
+// 0 when the token is not valid or has expired.
+func (g *GReaderController) tokenUser(kind string, token string) int {
+	parts := strings.Split(token, "/")
+	if len(parts) != 3 {
+		return 0
+	}
+	unix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= unix {
+		return 0
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(g.sign(kind, parts[0], parts[1]))) {
+		return 0
+	}
+	userId, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0
+	}
+
+	return userId
+}
+
+// route registers an authenticated Google Reader controller. Requests other
+// than GET need the action token as T form value. Strings are answered as
+// plain text and everything else as JSON.
+func (g *GReaderController) route(path string, d *sql.DB, controller func(*sql.DB, *http.Request) (interface{}, error)) {
+	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "GoogleLogin auth=")
+		userId := g.tokenUser(greaderAuthToken, auth)
+		if userId == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := userById(r.Context(), d, userId)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			panic(err)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+
+		err = r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !safeMethod(r.Method) && g.tokenUser(greaderActionToken, r.FormValue("T")) != user.Id {
+			// Clients ask for a new token on this header.
+			w.Header().Set("X-Reader-Google-Bad-Token", "true")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		data, err := controller(d, r)
+		if err != nil {
+			status := errorStatus(err)
+			http.Error(w, errorMessage(r, status, err), status)
+			return
+		}
+
+		if text, ok := data.(string); ok {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, text)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(data)
+		if err != nil {
+			panic(err)
+		}
+	})
+}
+
+func (g *GReaderController) ClientLogin(d *sql.DB, w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := checkCredentials(r, d, r.FormValue("Email"), r.FormValue("Passwd"))
+	if errors.Is(err, errInvalidCredentials) {
+		http.Error(w, "Error=BadAuthentication", http.StatusUnauthorized)
+		return
+	} else if errors.Is(err, errTooManySignIns) {
+		http.Error(w, "Error=BadAuthentication", http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	token := g.newToken(greaderAuthToken, user.Id)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "SID=%s\nLSID=%s\nAuth=%s\n", token, token, token)
+}
+
+// Token returns the action token the requests changing state send as T.
+func (g *GReaderController) Token(d *sql.DB, r *http.Request) (interface{}, error) {
+	return g.newToken(greaderActionToken, currentUser(r).Id), nil
+}
+
+func (g *GReaderController) UserInfo(d *sql.DB, r *http.Request) (interface{}, error) {
+	return map[string]string{
+		"userId":        strconv.Itoa(currentUser(r).Id),
+		"userName":      currentUser(r).Username,
+		"userProfileId": strconv.Itoa(currentUser(r).Id),
+		"userEmail":     currentUser(r).Username,
+	}, nil
+}
+
+func (g *GReaderController) SubscriptionList(d *sql.DB, r *http.Request) (interface{}, error) {
+	feeds, err := listFeeds(r.Context(), d, currentUser(r).Id)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []greaderSubscription{}
+	for _, feed := range feeds {
+		subscription := greaderSubscription{
+			Id:         "feed/" + strconv.Itoa(feed.Id),
+			Title:      feed.Title,
+			Categories: []greaderCategory{},
+			URL:        feed.URL,
+			HTMLURL:    feed.Link,
+		}
+		if feed.Folder != "" {
+			subscription.Categories = append(subscription.Categories, greaderCategory{
+				Id:    greaderLabel + feed.Folder,
+				Label: feed.Folder,
+			})
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return map[string]interface{}{"subscriptions": subscriptions}, nil
+}
+
+func (g *GReaderController) TagList(d *sql.DB, r *http.Request) (interface{}, error) {
+	folders, err := folders(r.Context(), d, currentUser(r).Id)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []greaderTag{{Id: greaderStarred}}
+	for _, folder := range folders {
+		tags = append(tags, greaderTag{Id: greaderLabel + folder.Name, Type: "folder"})
+	}
+
+	return map[string]interface{}{"tags": tags}, nil
+}
+
+func (g *GReaderController) StreamItemIds(d *sql.DB, r *http.Request) (interface{}, error) {
+	ids, continuation, err := g.streamIds(r.Context(), d, currentUser(r).Id, r.Form, r.FormValue("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	itemRefs := []greaderItemRef{}
+	for _, id := range ids {
+		itemRefs = append(itemRefs, greaderItemRef{Id: strconv.Itoa(id)})
+	}
+
+	return map[string]interface{}{"itemRefs": itemRefs, "continuation": continuation}, nil
+}
+
+func (g *GReaderController) StreamContents(d *sql.DB, r *http.Request) (interface{}, error) {
+	stream := r.PathValue("stream")
+	if stream == "" {
+		stream = r.FormValue("s")
+	}
+
+	ids, continuation, err := g.streamIds(r.Context(), d, currentUser(r).Id, r.Form, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := g.items(r.Context(), d, currentUser(r).Id, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return greaderStream{
+		Id:           stream,
+		Updated:      time.Now().Unix(),
+		Items:        items,
+		Continuation: continuation,
+	}, nil
+}
+
+func (g *GReaderController) StreamItemsContents(d *sql.DB, r *http.Request) (interface{}, error) {
+	ids, err := greaderItemIds(r.Form["i"])
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := g.items(r.Context(), d, currentUser(r).Id, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return greaderStream{
+		Id:      greaderReadingList,
+		Updated: time.Now().Unix(),
+		Items:   items,
+	}, nil
+}
+
+// EditTag adds the a tags to and removes the r tags from the i items. Only
+// the read and starred states are stored.
+func (g *GReaderController) EditTag(d *sql.DB, r *http.Request) (interface{}, error) {
+	ids, err := greaderItemIds(r.Form["i"])
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]bool{}
+	for _, tag := range r.Form["a"] {
+		switch greaderNormalize(tag) {
+		case greaderRead:
+			updates["is_read"] = true
+		case greaderKeptUnread:
+			updates["is_read"] = false
+		case greaderStarred:
+			updates["is_starred"] = true
+		}
+	}
+	for _, tag := range r.Form["r"] {
+		switch greaderNormalize(tag) {
+		case greaderRead:
+			updates["is_read"] = false
+		case greaderStarred:
+			updates["is_starred"] = false
+		}
+	}
+
+	for column, value := range updates {
+		var args queryArgs
+		conditions := []string{"feed_entries.id = ANY(" + args.add(pq.Array(ids)) + "::int[])"}
+		_, err := markEntries(r.Context(), d, currentUser(r).Id, column, value, conditions, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return "OK", nil
+}
+
+// MarkAllAsRead marks the s stream read up to the ts time in microseconds.
+func (g *GReaderController) MarkAllAsRead(d *sql.DB, r *http.Request) (interface{}, error) {
+	var args queryArgs
+	user := args.add(currentUser(r).Id)
+	condition, err := greaderStreamCondition(r.FormValue("s"), user, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []string{subscribed(user, true), condition}
+	if ts, err := strconv.ParseInt(r.FormValue("ts"), 10, 64); err == nil {
+		conditions = append(conditions, "feed_entries.pub_date <= "+args.add(time.UnixMicro(ts)))
+	}
+
+	_, err = markEntries(r.Context(), d, currentUser(r).Id, "is_read", true, conditions, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return "OK", nil
+}
+
+// streamIds returns the ids of the stream entries selected by the n, r, c,
+// xt, it, ot and nt form values, newest first unless r is "o", along with the
+// continuation of the next ones.
+func (g *GReaderController) streamIds(ctx context.Context, d *sql.DB, userId int, form url.Values, stream string) ([]int, string, error) {
+	var args queryArgs
+	user := args.add(userId)
+	condition, err := greaderStreamCondition(stream, user, &args)
+	if err != nil {
+		return nil, "", err
+	}
+	conditions := []string{subscribed(user, true), condition}
+
+	for _, target := range form["it"] {
+		condition, err := greaderStreamCondition(target, user, &args)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, condition)
+	}
+	for _, target := range form["xt"] {
+		condition, err := greaderStreamCondition(target, user, &args)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, "NOT "+condition)
+	}
+	if ot, err := strconv.ParseInt(form.Get("ot"), 10, 64); err == nil {
+		conditions = append(conditions, "feed_entries.pub_date >= "+args.add(time.Unix(ot, 0)))
+	}
+	if nt, err := strconv.ParseInt(form.Get("nt"), 10, 64); err == nil {
+		conditions = append(conditions, "feed_entries.pub_date <= "+args.add(time.Unix(nt, 0)))
+	}
+
+	order := " DESC"
+	compare := " < "
+	if form.Get("r") == "o" {
+		order = " ASC"
+		compare = " > "
+	}
+	if c, err := parseCursor(form.Get("c")); err == nil {
+		conditions = append(conditions, "(feed_entries.pub_date, feed_entries.id)"+compare+"("+args.add(c.PubDate)+", "+args.add(c.Id)+")")
+	}
+
+	count, err := strconv.Atoi(form.Get("n"))
+	if err != nil || count < 1 {
+		count = greaderDefaultCount
+	}
+	count = min(count, greaderMaxCount)
+
+	limit := args.add(count + 1)
+	rows, err := d.QueryContext(ctx, `
+		SELECT feed_entries.id, feed_entries.pub_date
+		FROM feed_entries
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY feed_entries.pub_date`+order+`, feed_entries.id`+order+`
+		LIMIT `+limit, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var cursors []cursor
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return nil, "", rows.Err()
+			}
+			break
+		}
+
+		var c cursor
+		err := rows.Scan(&c.Id, &c.PubDate)
+		if err != nil {
+			return nil, "", err
+		}
+		cursors = append(cursors, c)
+	}
+
+	continuation := ""
+	if len(cursors) > count {
+		cursors = cursors[:count]
+		continuation = cursors[count-1].String()
+	}
+
+	ids := []int{}
+	for _, c := range cursors {
+		ids = append(ids, c.Id)
+	}
+
+	return ids, continuation, nil
+}
+
+// items returns the entries of the user with ids in Google Reader form, in the
+// order of ids.
+func (g *GReaderController) items(ctx context.Context, d *sql.DB, userId int, ids []int) ([]greaderItem, error) {
+	rows, err := d.QueryContext(ctx, `
+		SELECT
+			feed_entries.id,
+			feed_entries.feed_id,
+			feeds.title,
+			feeds.link,
+			feed_entries.title,
+			feed_entries.link,
+			CASE WHEN feed_entries.content <> '' THEN feed_entries.content ELSE feed_entries.description END,
+			feed_entries.pub_date,
+			`+entryState("is_read", "$2")+`,
+			`+entryState("is_starred", "$2")+`,
+			COALESCE(folders.name, '')
+		FROM feed_entries
+		JOIN feeds ON feeds.id = feed_entries.feed_id
+		JOIN subscriptions ON subscriptions.feed_id = feeds.id AND subscriptions.user_id = $2
+		LEFT JOIN folders ON folders.id = subscriptions.folder_id
+		WHERE feed_entries.id = ANY($1::int[])`, pq.Array(ids), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	items := map[int]greaderItem{}
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return nil, rows.Err()
+			}
+			break
+		}
+
+		var id, feedId int
+		var feedTitle, feedLink, link, folder string
+		var pubDate time.Time
+		var isRead, isStarred bool
+		item := greaderItem{Summary: greaderContent{Direction: "ltr"}}
+		err := rows.Scan(&id, &feedId, &feedTitle, &feedLink, &item.Title, &link, &item.Summary.Content, &pubDate, &isRead, &isStarred, &folder)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Id = fmt.Sprintf("%s%016x", greaderItemPrefix, id)
+		item.CrawlTimeMsec = strconv.FormatInt(pubDate.UnixMilli(), 10)
+		item.TimestampUsec = strconv.FormatInt(pubDate.UnixMicro(), 10)
+		item.Published = pubDate.Unix()
+		item.Updated = pubDate.Unix()
+		item.Canonical = []greaderLink{{Href: link}}
+		item.Alternate = []greaderLink{{Href: link, Type: "text/html"}}
+		item.Origin = greaderOrigin{StreamId: "feed/" + strconv.Itoa(feedId), Title: feedTitle, HTMLURL: feedLink}
+		item.Categories = []string{greaderReadingList}
+		if folder != "" {
+			item.Categories = append(item.Categories, greaderLabel+folder)
+		}
+		if isRead {
+			item.Categories = append(item.Categories, greaderRead)
+		}
+		if isStarred {
+			item.Categories = append(item.Categories, greaderStarred)
+		}
+		items[id] = item
+	}
+
+	ordered := []greaderItem{}
+	for _, id := range ids {
+		if item, ok := items[id]; ok {
+			ordered = append(ordered, item)
+		}
+	}
+
+	return ordered, nil
+}
+
+// greaderNormalize replaces the user id of user streams with "-".
+func greaderNormalize(stream string) string {
+	parts := strings.SplitN(stream, "/", 3)
+	if len(parts) == 3 && parts[0] == "user" {
+		return "user/-/" + parts[2]
+	}
+
+	return stream
+}
+
+// greaderStreamCondition returns the condition on feed_entries selecting the
+// entries of stream for the user placeholder.
+func greaderStreamCondition(stream string, user string, args *queryArgs) (string, error) {
+	stream = greaderNormalize(stream)
+	switch {
+	case stream == "" || stream == greaderReadingList:
+		return "true", nil
+	case stream == greaderRead:
+		return entryState("is_read", user), nil
+	case stream == greaderKeptUnread:
+		return "NOT " + entryState("is_read", user), nil
+	case stream == greaderStarred:
+		return entryState("is_starred", user), nil
+	case strings.HasPrefix(stream, "feed/"):
+		id, err := strconv.Atoi(strings.TrimPrefix(stream, "feed/"))
+		if err != nil {
+			return "", badRequest(fmt.Errorf("unknown stream %q", stream))
+		}
+		return "feed_entries.feed_id = " + args.add(id), nil
+	case strings.HasPrefix(stream, greaderLabel):
+		return `feed_entries.feed_id IN (
+			SELECT subscriptions.feed_id
+			FROM subscriptions, folders
+			WHERE
+				folders.id = subscriptions.folder_id AND
+				folders.user_id = ` + user + ` AND
+				folders.name = ` + args.add(strings.TrimPrefix(stream, greaderLabel)) + `)`, nil
+	default:
+		return "", badRequest(fmt.Errorf("unknown stream %q", stream))
+	}
+}
+
+// greaderItemIds parses item ids given either in their long hexadecimal form
+// or as decimal numbers.
+func greaderItemIds(values []string) ([]int, error) {
+	var ids []int
+	for _, value := range values {
+		var id int64
+		var err error
+		if strings.HasPrefix(value, greaderItemPrefix) {
+			id, err = strconv.ParseInt(strings.TrimPrefix(value, greaderItemPrefix), 16, 64)
+		} else {
+			id, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return nil, badRequest(errors.New("invalid item id " + value))
+		}
+		if !slices.Contains(ids, int(id)) {
+			ids = append(ids, int(id))
+		}
+	}
+
+	return ids, nil
+}
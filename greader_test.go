@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGReaderItemIds(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []int
+	}{
+		{"none", nil, nil},
+		{"long form", []string{greaderItemPrefix + "000000000000002a"}, []int{42}},
+		{"long form upper case", []string{greaderItemPrefix + "00000000000000FF"}, []int{255}},
+		{"decimal", []string{"42"}, []int{42}},
+		{"mixed and repeated", []string{"7", greaderItemPrefix + "0000000000000007", "8"}, []int{7, 8}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := greaderItemIds(test.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("greaderItemIds(%q) = %v, want %v", test.values, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGReaderItemIdsRoundTrip(t *testing.T) {
+	for _, id := range []int{1, 42, 1 << 40} {
+		value := fmt.Sprintf("%s%016x", greaderItemPrefix, id)
+		got, err := greaderItemIds([]string{value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0] != id {
+			t.Errorf("greaderItemIds(%q) = %v, want [%d]", value, got, id)
+		}
+	}
+}
+
+func TestGReaderItemIdsInvalid(t *testing.T) {
+	for _, value := range []string{"", "abc", greaderItemPrefix + "xyz", "tag:google.com,2005:reader/item/", "1.5"} {
+		_, err := greaderItemIds([]string{"1", value})
+		if errorStatus(err) != http.StatusBadRequest {
+			t.Errorf("greaderItemIds(%q) error = %v, want a bad request", value, err)
+		}
+	}
+}
+
+func TestGReaderTokens(t *testing.T) {
+	greader := &GReaderController{secret: []byte("secret")}
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name  string
+		kind  string
+		token string
+		want  int
+	}{
+		{"auth", greaderAuthToken, greader.newToken(greaderAuthToken, 3), 3},
+		{"action", greaderActionToken, greader.newToken(greaderActionToken, 3), 3},
+		{"other kind", greaderActionToken, greader.newToken(greaderAuthToken, 3), 0},
+		{"other secret", greaderAuthToken, (&GReaderController{secret: []byte("other")}).newToken(greaderAuthToken, 3), 0},
+		{"expired", greaderAuthToken, "3/" + expired + "/" + greader.sign(greaderAuthToken, "3", expired), 0},
+		{"other user", greaderAuthToken, "4" + greader.newToken(greaderAuthToken, 3)[1:], 0},
+		{"malformed", greaderAuthToken, "3/abc", 0},
+		{"empty", greaderAuthToken, "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := greader.tokenUser(test.kind, test.token)
+			if got != test.want {
+				t.Errorf("tokenUser(%q, %q) = %d, want %d", test.kind, test.token, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Health is the answer of /healthz and /readyz, Checks holding "ok" or the
+// reason each check failed.
+type Health struct {
+	Status string
+	Checks map[string]string `json:",omitempty"`
+}
+
+func writeHealth(w http.ResponseWriter, health Health) {
+	status := http.StatusOK
+	for _, check := range health.Checks {
+		if check != "ok" {
+			health.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	if health.Status == "" {
+		health.Status = "ok"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
+}
+
+// Healthz answers as long as the process serves requests.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, Health{})
+}
+
+// Readyz checks that the database is reachable and migrated and that the
+// scheduler ticked within the last two poll intervals.
+func Readyz(d *sql.DB, config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		checks := map[string]string{
+			"database":   "ok",
+			"migrations": "ok",
+			"scheduler":  "ok",
+		}
+
+		err := d.PingContext(ctx)
+		if err != nil {
+			checks["database"] = err.Error()
+		}
+
+		pending, err := pendingMigrations(ctx, d)
+		if err != nil {
+			checks["migrations"] = err.Error()
+		} else if len(pending) > 0 {
+			checks["migrations"] = "pending " + strings.Join(pending, ", ")
+		}
+
+		lastTick := lastSchedulerTick.Load()
+		if lastTick == 0 {
+			checks["scheduler"] = "no successful tick yet"
+		} else if since := time.Since(time.Unix(0, lastTick)); since > 2*config.PollInterval {
+			checks["scheduler"] = fmt.Sprintf("last successful tick %s ago", since.Round(time.Second))
+		}
+
+		writeHealth(w, Health{Checks: checks})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// newLogger returns the logger writing to stderr in the format and from the
+// level of the config.
+func newLogger(config *Config) *slog.Logger {
+	options := &slog.HandlerOptions{Level: config.LogLevel}
+	if config.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, options))
+	}
+
+	return slog.New(slog.NewTextHandler(os.Stderr, options))
+}
+
+// statusRecorder remembers the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.size += n
+
+	return n, err
+}
+
+// statusCode returns the status of the response, 200 when the handler wrote
+// nothing.
+func (s *statusRecorder) statusCode() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+
+	return s.status
+}
+
+// Unwrap lets http.ResponseController reach the flushing and deadlines of the
+// underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// withRequestLog gives every request an id, the X-Request-Id header of the
+// request when there is a valid one, and logs the request once answered.
+func withRequestLog(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if !validRequestId(id) {
+			id = newRequestId()
+		}
+		w.Header().Set("X-Request-Id", id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIdContextKey, id))
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			slog.InfoContext(r.Context(), "request",
+				"request_id", id,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", recorder.statusCode(),
+				"size", recorder.size,
+				"duration", time.Since(start),
+				"remote_addr", r.RemoteAddr)
+		}()
+
+		handler.ServeHTTP(recorder, r)
+	})
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"rss-app/html"
-	"time"
+	"rss-app/rss"
 
 	_ "github.com/lib/pq"
 )
@@ -15,83 +19,131 @@ import (
 type Response struct {
 	Data          interface{}
 	FilterOptions FilterOptions
+	Views         []SavedView
+	User          *User
+	CSRFToken     string
+	// Notice is shown above the page, telling the outcome of the form posted.
+	Notice string
+	// Path is the path of the page, which its links to other pages of the
+	// same list point to. Forms posted render the entries of the home page.
+	Path string
+}
+
+// Confirmation is the data of the page asking to confirm a deletion, Action
+// being where the confirmation is posted and Cancel where to go back to.
+type Confirmation struct {
+	Question string
+	Action   string
+	Cancel   string
 }
 
 type FilterOptions struct {
-	Feeds []Feed
+	Feeds   []Feed
+	Folders []Folder
+	FeedEntryFilter
 }
 
-func route(path string, d *sql.DB, controller func(*sql.DB, http.ResponseWriter, *http.Request) (*Response, string, error)) {
-	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+// render runs the controller and renders the template it returns, or the error
+// page when it fails. Controllers returning a nil response have already
+// answered, for instance by redirecting.
+func render(d *sql.DB, controller func(*sql.DB, http.ResponseWriter, *http.Request) (*Response, string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		err := r.ParseForm()
 		if err != nil {
-			panic(err)
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
 		}
 
 		response, templateName, err := controller(d, w, r)
 		if err != nil {
-			panic(err)
+			status := errorStatus(err)
+			writeError(w, r, status, errorMessage(r, status, err))
+			return
+		}
+		if response == nil {
+			return
 		}
 
-		err = html.ParseWithFilter(templateName).Execute(w, &response)
+		response.User = currentUser(r)
+		response.CSRFToken = csrfToken(r)
+		response.Path = "/"
+		if safeMethod(r.Method) {
+			response.Path = r.URL.Path
+		}
+		if response.User != nil {
+			response.Views, err = savedViews(r.Context(), d, response.User.Id)
+			if err != nil {
+				status := errorStatus(err)
+				writeError(w, r, status, errorMessage(r, status, err))
+				return
+			}
+		}
+
+		// The page is rendered first so a failing template ends on the error
+		// page rather than half a page.
+		var page bytes.Buffer
+		err = html.ParseWithFilter(templateName).Execute(&page, &response)
 		if err != nil {
 			panic(err)
 		}
+		page.WriteTo(w)
+	}
+}
+
+func NotFound(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	return nil, "", &statusError{status: http.StatusNotFound, err: errors.New("page not found")}
+}
+
+// route registers a page for signed in users, sending the others to the login
+// page. Forms posted to it must carry the CSRF token.
+func route(path string, d *sql.DB, controller func(*sql.DB, http.ResponseWriter, *http.Request) (*Response, string, error)) {
+	http.HandleFunc(path, authenticated(d, csrfProtected(render(d, controller)), redirectToLogin))
+}
+
+// publishedRoute registers a page controller at a path ending in a wildcard,
+// along with publish serving the same path followed by the extension of a
+// published document, which the mux patterns cannot tell apart.
+func publishedRoute(path string, d *sql.DB, controller func(*sql.DB, http.ResponseWriter, *http.Request) (*Response, string, error), publish func(*sql.DB, http.ResponseWriter, *http.Request)) {
+	page := authenticated(d, csrfProtected(render(d, controller)), redirectToLogin)
+	document := authenticated(d, func(w http.ResponseWriter, r *http.Request) {
+		publish(d, w, r)
+	}, basicAuthRequired)
+	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if published(r) {
+			document(w, r)
+			return
+		}
+		page(w, r)
 	})
 }
 
+func publicRoute(path string, d *sql.DB, controller func(*sql.DB, http.ResponseWriter, *http.Request) (*Response, string, error)) {
+	http.HandleFunc(path, sameOriginOnly(render(d, controller)))
+}
+
 func Index(db *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
-	feedId := r.FormValue("FeedId")
-	var rows *sql.Rows
-	var err error
-	if feedId != "" {
-		rows, err = db.Query(`
-			SELECT id, title, link, description, pub_date 
-			FROM feed_entries 
-			WHERE feed_id = $1
-			ORDER by pub_date DESC, title`,
-			feedId)
-	} else {
-		rows, err = db.Query(`
-			SELECT feed_entries.id, feed_entries.title, feed_entries.link, feed_entries.description, feed_entries.pub_date 
-			FROM feed_entries, feeds
-			WHERE feeds.id = feed_id 
-				AND is_hidden = false
-			ORDER by pub_date DESC, title`,
-		)
-	}
+	filter := parseFeedEntryFilter(r.Form)
+	filter.userId = currentUser(r).Id
+	page, err := filter.page(r.Context(), db)
 	if err != nil {
 		return nil, "", err
 	}
 
-	var feedEntries []FeedEntry
-	for {
-		var feedEntry FeedEntry
-		if rows.Next() {
-			err := rows.Scan(&feedEntry.Id, &feedEntry.Title, &feedEntry.Link, &feedEntry.Description, &feedEntry.PubDate.Time)
-			if err != nil {
-				return nil, "", err
-			}
-
-			feedEntries = append(feedEntries, feedEntry)
-		} else {
-			if rows.Err() != nil {
-				return nil, "", rows.Err()
-			}
-			break
-		}
-	}
-
-	filterOptions, err := filterOptions(db)
+	filterOptions, err := filterOptions(db, filter.userId)
 	if err != nil {
 		return nil, "", err
 	}
+	filterOptions.FeedEntryFilter = filter
 
-	return &Response{Data: feedEntries, FilterOptions: *filterOptions}, "html/feed_entries/list.html", nil
+	return &Response{Data: page, FilterOptions: *filterOptions}, "html/feed_entries/list.html", nil
 }
 
-func filterOptions(db *sql.DB) (*FilterOptions, error) {
-	rows, err := db.Query("SELECT id, title FROM feeds WHERE is_hidden = false")
+func filterOptions(db *sql.DB, userId int) (*FilterOptions, error) {
+	rows, err := db.Query(`
+		SELECT feeds.id, feeds.title, subscriptions.is_hidden
+		FROM feeds, subscriptions
+		WHERE subscriptions.feed_id = feeds.id AND subscriptions.user_id = $1
+		ORDER BY subscriptions.is_hidden, feeds.title`, userId)
 	if err != nil {
 		return nil, err
 	}
@@ -105,39 +157,123 @@ func filterOptions(db *sql.DB) (*FilterOptions, error) {
 			break
 		}
 		var feed Feed
-		err = rows.Scan(&feed.Id, &feed.Title)
+		err = rows.Scan(&feed.Id, &feed.Title, &feed.IsHidden)
 		if err != nil {
 			return nil, err
 		}
 		filterOptions.Feeds = append(filterOptions.Feeds, feed)
 	}
 
+	filterOptions.Folders, err = folders(context.Background(), db, userId)
+	if err != nil {
+		return nil, err
+	}
+
 	return &filterOptions, nil
 }
 
-func startWebServer(db *sql.DB) error {
-	var feeds FeedsController
-	var feedEntries FeedEntriesController
+func startWebServer(db *sql.DB, config *Config) error {
+	feeds := FeedsController{refreshInterval: config.RefreshInterval}
+	feedEntries := FeedEntriesController{refreshInterval: config.RefreshInterval}
+	var views SavedViewsController
+	var sessions SessionsController
+	var publish PublishController
+	publicRoute("GET /login", db, sessions.GetLogin)
+	publicRoute("POST /login", db, sessions.SetLogin)
+	route("POST /logout", db, sessions.Logout)
+	route("/", db, NotFound)
 	route("GET /{$}", db, Index)
 	route("GET /feed_entries/show/{Id}", db, feedEntries.Show)
+	route("POST /feed_entries/read/{Id}", db, feedEntries.SetRead)
+	route("POST /feed_entries/unread/{Id}", db, feedEntries.SetUnread)
+	route("POST /feed_entries/read", db, feedEntries.SetAllRead)
+	route("POST /feed_entries/star/{Id}", db, feedEntries.ToggleStarred)
+	route("POST /feed_entries/refresh", db, feedEntries.Refresh)
+	route("GET /starred", db, feedEntries.Starred)
 	route("GET /feeds/edit/{Id}", db, feeds.GetEdit)
 	route("GET /feeds/edit", db, feeds.GetEdit)
 	route("POST /feeds/edit", db, feeds.SetEdit)
-	route("GET /feeds/delete/{Id}", db, feeds.Delete)
+	route("GET /feeds/delete/{Id}", db, feeds.GetDelete)
+	route("POST /feeds/delete/{Id}", db, feeds.Delete)
 	route("GET /feeds/list", db, feeds.List)
+	publishedRoute("GET /feeds/{Id}", db, feeds.Show, publish.Feed)
+	route("POST /feeds/refresh/{Id}", db, feeds.Refresh)
+	route("POST /feeds/refresh", db, feeds.RefreshAll)
+	publishedRoute("GET /views/{Id}", db, views.Show, publish.View)
+	route("POST /views/edit", db, views.SetEdit)
+	route("GET /views/delete/{Id}", db, views.GetDelete)
+	route("POST /views/delete/{Id}", db, views.Delete)
+
+	var api APIController
+	http.HandleFunc(apiPrefix, authenticated(db, apiNotFound, apiUnauthorized))
+	apiRoute("GET /api/v1/feeds", db, api.ListFeeds)
+	apiRoute("POST /api/v1/feeds", db, api.CreateFeed)
+	apiRoute("PUT /api/v1/feeds/{Id}", db, api.UpdateFeed)
+	apiRoute("DELETE /api/v1/feeds/{Id}", db, api.DeleteFeed)
+	apiRoute("GET /api/v1/entries", db, api.ListEntries)
+	apiRoute("GET /api/v1/entries/{Id}", db, api.GetEntry)
+	apiRoute("PUT /api/v1/entries/{Id}/read", db, api.SetRead)
+	apiRoute("DELETE /api/v1/entries/{Id}/read", db, api.SetRead)
+	apiRoute("PUT /api/v1/entries/{Id}/starred", db, api.SetStarred)
+	apiRoute("DELETE /api/v1/entries/{Id}/starred", db, api.SetStarred)
+
+	var fever FeverController
+	// Clients post to /fever/?api or /fever?api, the redirect of the mux
+	// from one to the other dropping the body.
+	for _, path := range []string{"/fever/", "/fever"} {
+		http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			fever.Handle(db, w, r)
+		})
+	}
+
+	greader := newGReaderController(config)
+	http.HandleFunc("/accounts/ClientLogin", func(w http.ResponseWriter, r *http.Request) {
+		greader.ClientLogin(db, w, r)
+	})
+	greader.route("/reader/api/0/token", db, greader.Token)
+	greader.route("/reader/api/0/user-info", db, greader.UserInfo)
+	greader.route("/reader/api/0/subscription/list", db, greader.SubscriptionList)
+	greader.route("/reader/api/0/tag/list", db, greader.TagList)
+	greader.route("/reader/api/0/stream/items/ids", db, greader.StreamItemIds)
+	greader.route("/reader/api/0/stream/items/contents", db, greader.StreamItemsContents)
+	greader.route("/reader/api/0/stream/contents/{stream...}", db, greader.StreamContents)
+	greader.route("POST /reader/api/0/edit-tag", db, greader.EditTag)
+	greader.route("POST /reader/api/0/mark-all-as-read", db, greader.MarkAllAsRead)
+
+	for _, extension := range publishExtensions {
+		http.HandleFunc("GET /all"+extension, authenticated(db, func(w http.ResponseWriter, r *http.Request) {
+			publish.Handle(db, w, r)
+		}, basicAuthRequired))
+	}
 
 	http.Handle("/static/", http.FileServer(http.Dir("")))
+	http.HandleFunc("GET /events", authenticated(db, Events(db), eventsUnauthorized))
+	go listenFeedEvents(config)
 
-	err := http.ListenAndServe(":8080", nil)
-	if err != nil {
-		return err
+	http.HandleFunc("GET /metrics", authenticated(db, Metrics(db), basicAuthRequired))
+	http.HandleFunc("GET /healthz", Healthz)
+	http.HandleFunc("GET /readyz", Readyz(db, config))
+
+	handler := withRequestLog(withMetrics(http.DefaultServeMux))
+	if config.TLSCert != "" {
+		return http.ListenAndServeTLS(config.ListenAddr, config.TLSCert, config.TLSKey, handler)
 	}
 
-	return nil
+	return http.ListenAndServe(config.ListenAddr, handler)
 }
 
 func main() {
-	db, err := newDB()
+	config, args, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "rss-app: config:", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(newLogger(config))
+	rss.UserAgent = config.UserAgent
+
+	db, err := newDB(config.DatabaseURL)
 	if err != nil {
 		panic(err)
 	}
@@ -147,70 +283,30 @@ func main() {
 		panic(err)
 	}
 
-	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+	if len(args) > 0 && args[0] == "migrate" {
 		err := migrate(db)
 		if err != nil {
 			panic(fmt.Errorf("migrate: %w", err))
 		}
+	} else if len(args) > 0 && args[0] == "refresh" {
+		err := refreshFeeds(db, config, args[1:])
+		if err != nil {
+			panic(fmt.Errorf("refresh: %w", err))
+		}
+	} else if len(args) > 0 && args[0] == "useradd" {
+		err := addUser(db, args[1:])
+		if err != nil {
+			panic(fmt.Errorf("useradd: %w", err))
+		}
 	} else {
 		go func() {
-			err := startWebServer(db)
+			err := startWebServer(db, config)
 			if err != nil {
-				panic(err)
+				slog.Error("web server", "error", err)
+				os.Exit(1)
 			}
 		}()
 
-		ticker := time.NewTicker(5 * time.Minute)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				rows, err := db.QueryContext(context.Background(), `
-				SELECT id, url, is_hidden 
-				FROM feeds 
-				WHERE 
-					update_at < NOW() AND
-					is_updating = false 
-				ORDER BY id 
-				LIMIT 5`)
-				if err != nil {
-					panic(err)
-				}
-
-				for {
-					hasRows := rows.Next()
-					if !hasRows {
-						if rows.Err() != nil {
-							panic(rows.Err())
-						}
-						break
-					}
-
-					var feed Feed
-					err := rows.Scan(&feed.Id, &feed.URL, &feed.IsHidden)
-					if err != nil {
-						panic(err)
-					}
-
-					go func(feed Feed) {
-						_, err := db.Exec("UPDATE feeds SET is_updating = true WHERE id = $1", feed.Id)
-						if err != nil {
-							panic(err)
-						}
-
-						err = feed.update(db)
-						if err != nil {
-							panic(err)
-						}
-
-						_, err = db.Exec("UPDATE feeds SET is_updating = false, update_at = NOW() + interval '10 minutes' WHERE id = $1", feed.Id)
-						if err != nil {
-							panic(err)
-						}
-					}(feed)
-				}
-			}
-		}
+		runScheduler(db, config)
 	}
 }
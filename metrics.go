@@ -0,0 +1,218 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histograms.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// counterVec is a counter for each combination of its label values.
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: map[string]float64{}}
+}
+
+func (c *counterVec) add(n float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(labelValues, "\x00")] += n
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelPairs(c.labels, key, ""), formatFloat(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram for each combination of its label values.
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogram{}}
+}
+
+func (h *histogramVec) observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := strings.Join(labelValues, "\x00")
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		series := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, key, formatFloat(bound)), series.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, key, "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelPairs(h.labels, key, ""), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelPairs(h.labels, key, ""), series.count)
+	}
+}
+
+// writeGauge writes a metric whose value is read when scraped.
+func writeGauge(w io.Writer, name, help, kind string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, kind, name, formatFloat(value))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+// labelPairs formats the label values joined in key as {name="value",...},
+// adding the le label of histogram buckets when given.
+func labelPairs(labels []string, key string, le string) string {
+	var pairs []string
+	if len(labels) > 0 {
+		for i, value := range strings.Split(key, "\x00") {
+			pairs = append(pairs, labels[i]+"="+strconv.Quote(value))
+		}
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	feedFetches = newCounterVec("rss_feed_fetches_total",
+		"Feed updates by result: ok, fetch_error when the feed could not be fetched or read, error otherwise.", "result")
+	feedFetchDuration = newHistogramVec("rss_feed_fetch_duration_seconds",
+		"Duration of the feed updates.", latencyBuckets)
+	feedEntriesIngested = newCounterVec("rss_feed_entries_ingested_total",
+		"New entries saved by the feed updates.")
+	httpRequests = newCounterVec("rss_http_requests_total",
+		"HTTP requests by route and status code.", "route", "code")
+	httpRequestDuration = newHistogramVec("rss_http_request_duration_seconds",
+		"Duration of the HTTP requests by route.", latencyBuckets, "route")
+)
+
+// withMetrics serves the requests with mux, recovering from the panics of its
+// handlers, and counts them and their latency by the route pattern they
+// matched.
+func withMetrics(mux *http.ServeMux) http.Handler {
+	handler := withRecovery(mux)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "none"
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			httpRequests.add(1, route, strconv.Itoa(recorder.statusCode()))
+			httpRequestDuration.observe(time.Since(start).Seconds(), route)
+		}()
+
+		handler.ServeHTTP(recorder, r)
+	})
+}
+
+// Metrics serves the metrics in the Prometheus text format, reading the state
+// of the feeds and of the connection pool when scraped.
+func Metrics(d *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ok, failing, disabled int
+		var lag float64
+		err := d.
+			QueryRowContext(r.Context(), `
+				SELECT
+					COUNT(*) FILTER (WHERE last_error = '' AND is_disabled = false),
+					COUNT(*) FILTER (WHERE last_error <> '' AND is_disabled = false),
+					COUNT(*) FILTER (WHERE is_disabled),
+					COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(update_at) FILTER (WHERE update_at < NOW() AND is_updating = false AND is_disabled = false)), 0)
+				FROM feeds`).
+			Scan(&ok, &failing, &disabled, &lag)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "metrics", "request_id", requestId(r), "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		feedFetches.write(w)
+		feedFetchDuration.write(w)
+		feedEntriesIngested.write(w)
+		httpRequests.write(w)
+		httpRequestDuration.write(w)
+
+		fmt.Fprintf(w, "# HELP rss_feeds Feeds by the result of their last update, disabled after failing too often.\n# TYPE rss_feeds gauge\n")
+		fmt.Fprintf(w, "rss_feeds{state=\"ok\"} %d\nrss_feeds{state=\"failing\"} %d\nrss_feeds{state=\"disabled\"} %d\n", ok, failing, disabled)
+		writeGauge(w, "rss_scheduler_lag_seconds", "Time since the oldest feed waiting for an update was due.", "gauge", lag)
+
+		stats := d.Stats()
+		writeGauge(w, "rss_db_open_connections", "Open database connections.", "gauge", float64(stats.OpenConnections))
+		writeGauge(w, "rss_db_in_use_connections", "Database connections in use.", "gauge", float64(stats.InUse))
+		writeGauge(w, "rss_db_idle_connections", "Idle database connections.", "gauge", float64(stats.Idle))
+		writeGauge(w, "rss_db_wait_count_total", "Waits for a database connection.", "counter", float64(stats.WaitCount))
+		writeGauge(w, "rss_db_wait_duration_seconds_total", "Time spent waiting for a database connection.", "counter", stats.WaitDuration.Seconds())
+	}
+}
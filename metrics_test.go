@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabelPairs(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels []string
+		key    string
+		le     string
+		want   string
+	}{
+		{"no labels", nil, "", "", ""},
+		{"one label", []string{"result"}, "ok", "", `{result="ok"}`},
+		{"two labels", []string{"route", "code"}, "GET /feeds/{Id}\x00200", "", `{route="GET /feeds/{Id}",code="200"}`},
+		{"quoted value", []string{"route"}, `say "hi"\`, "", `{route="say \"hi\"\\"}`},
+		{"bucket only", nil, "", "0.5", `{le="0.5"}`},
+		{"labels and bucket", []string{"route"}, "/", "+Inf", `{route="/",le="+Inf"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := labelPairs(test.labels, test.key, test.le)
+			if got != test.want {
+				t.Errorf("labelPairs(%q, %q, %q) = %s, want %s", test.labels, test.key, test.le, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCounterVecWrite(t *testing.T) {
+	counter := newCounterVec("test_total", "Test counter.", "result")
+	counter.add(1, "ok")
+	counter.add(2, "error")
+	counter.add(0.5, "ok")
+
+	var out strings.Builder
+	counter.write(&out)
+
+	want := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{result="error"} 2
+test_total{result="ok"} 1.5
+`
+	if out.String() != want {
+		t.Errorf("write:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestHistogramVecWrite(t *testing.T) {
+	histogram := newHistogramVec("test_seconds", "Test histogram.", []float64{0.1, 1}, "route")
+	histogram.observe(0.05, "/")
+	histogram.observe(0.5, "/")
+	histogram.observe(3, "/")
+
+	var out strings.Builder
+	histogram.write(&out)
+
+	want := `# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{route="/",le="0.1"} 1
+test_seconds_bucket{route="/",le="1"} 2
+test_seconds_bucket{route="/",le="+Inf"} 3
+test_seconds_sum{route="/"} 3.55
+test_seconds_count{route="/"} 3
+`
+	if out.String() != want {
+		t.Errorf("write:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestHistogramVecWriteWithoutLabels(t *testing.T) {
+	histogram := newHistogramVec("test_seconds", "Test histogram.", []float64{1})
+	histogram.observe(2)
+
+	var out strings.Builder
+	histogram.write(&out)
+
+	want := `# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="1"} 0
+test_seconds_bucket{le="+Inf"} 1
+test_seconds_sum 2
+test_seconds_count 1
+`
+	if out.String() != want {
+		t.Errorf("write:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
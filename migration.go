@@ -5,16 +5,85 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
 )
 
+const migrationsRoot = "migrations"
+
+// migrationNames returns the file names of the migrations in the order they
+// are applied, by the number they are named after.
+func migrationNames() ([]string, error) {
+	migrations, err := os.ReadDir(migrationsRoot)
+	if err != nil {
+		return nil, fmt.Errorf("readDir migrations: %w", err)
+	}
+
+	numbers := map[string]int{}
+	var fileNames []string
+	for _, migration := range migrations {
+		name := migration.Name()
+		number, err := strconv.Atoi(strings.TrimSuffix(name, ".sql"))
+		if err != nil || !strings.HasSuffix(name, ".sql") {
+			return nil, fmt.Errorf("migration %s: expected a name like 1.sql", name)
+		}
+		numbers[name] = number
+		fileNames = append(fileNames, name)
+	}
+	slices.SortFunc(fileNames, func(a, b string) int {
+		return numbers[a] - numbers[b]
+	})
+
+	return fileNames, nil
+}
+
+// pendingMigrations returns the file names of the migrations not applied yet.
+func pendingMigrations(ctx context.Context, d *sql.DB) ([]string, error) {
+	fileNames, err := migrationNames()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.QueryContext(ctx, "SELECT name FROM migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return nil, rows.Err()
+			}
+			break
+		}
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		applied[name] = true
+	}
+
+	var pending []string
+	for _, fileName := range fileNames {
+		if !applied[fileName] {
+			pending = append(pending, fileName)
+		}
+	}
+
+	return pending, nil
+}
+
 func migrate(d *sql.DB) error {
-	root := "migrations"
-	migrations, err := os.ReadDir(root)
+	fileNames, err := migrationNames()
 	if err != nil {
-		return fmt.Errorf("readDir migrations: %w", err)
+		return err
 	}
 
 	tx, err := d.BeginTx(context.Background(), &sql.TxOptions{Isolation: 6})
@@ -22,14 +91,10 @@ func migrate(d *sql.DB) error {
 		return fmt.Errorf("begin transaction: %w", err)
 	}
 
-	var fileNames []string
-	for _, migration := range migrations {
-		fileNames = append(fileNames, migration.Name())
-	}
-	slices.Sort(fileNames)
+	var applied []string
 
 	for _, fileName := range fileNames {
-		file, err := os.ReadFile(filepath.Join(root, fileName))
+		file, err := os.ReadFile(filepath.Join(migrationsRoot, fileName))
 		if err != nil {
 			err2 := tx.Rollback()
 			return fmt.Errorf("read file %s: %w", fileName, errors.Join(err, err2))
@@ -54,6 +119,7 @@ func migrate(d *sql.DB) error {
 			err2 := tx.Rollback()
 			return fmt.Errorf("INSERT %s: %w", fileName, errors.Join(err, err2))
 		}
+		applied = append(applied, fileName)
 	}
 
 	err = tx.Commit()
@@ -62,5 +128,10 @@ func migrate(d *sql.DB) error {
 		return fmt.Errorf("commit transaction: %w", errors.Join(err, err2))
 	}
 
+	for _, fileName := range applied {
+		slog.Info("migration applied", "name", fileName)
+	}
+	slog.Info("migrations done", "applied", len(applied), "total", len(fileNames))
+
 	return nil
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestMigrationNames(t *testing.T) {
+	names, err := migrationNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 {
+		t.Fatal("no migrations")
+	}
+	for i, name := range names {
+		if want := strconv.Itoa(i+1) + ".sql"; name != want {
+			t.Fatalf("migration %d is %s, want %s", i, name, want)
+		}
+	}
+}
+
+func TestMigrationNamesInvalid(t *testing.T) {
+	for _, name := range []string{"1.txt", "first.sql", "README"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.Mkdir(filepath.Join(dir, migrationsRoot), 0o755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range []string{"1.sql", name} {
+				err := os.WriteFile(filepath.Join(dir, migrationsRoot, file), nil, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			chdir(t, dir)
+
+			_, err = migrationNames()
+			if err == nil {
+				t.Errorf("migrationNames succeeded with %s", name)
+			}
+		})
+	}
+}
+
+// chdir changes the working directory for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
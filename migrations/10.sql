@@ -0,0 +1 @@
+ALTER TABLE feed_entries ADD COLUMN is_read boolean NOT NULL DEFAULT false;
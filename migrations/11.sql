@@ -0,0 +1 @@
+ALTER TABLE feed_entries ADD COLUMN is_starred boolean NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+ALTER TABLE feeds ADD COLUMN retention_days int NOT NULL DEFAULT 0;
+ALTER TABLE feeds ADD COLUMN retention_count int NOT NULL DEFAULT 0;
+ALTER TABLE feeds ADD COLUMN keep_forever boolean NOT NULL DEFAULT false;
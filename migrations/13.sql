@@ -0,0 +1,7 @@
+ALTER TABLE feed_entries ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', title), 'A') ||
+	setweight(to_tsvector('english', regexp_replace(description, '<[^>]*>', ' ', 'g')), 'B') ||
+	setweight(to_tsvector('english', regexp_replace(content, '<[^>]*>', ' ', 'g')), 'C')
+) STORED;
+
+CREATE INDEX feed_entries_search ON feed_entries USING GIN (search);
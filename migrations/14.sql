@@ -0,0 +1,3 @@
+ALTER TABLE feed_entries ADD COLUMN enclosure_url text NOT NULL DEFAULT '';
+ALTER TABLE feed_entries ADD COLUMN enclosure_type text NOT NULL DEFAULT '';
+ALTER TABLE feed_entries ADD COLUMN enclosure_length text NOT NULL DEFAULT '';
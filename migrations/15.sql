@@ -0,0 +1,5 @@
+CREATE TABLE saved_views (
+	id serial primary key NOT NULL,
+	name text NOT NULL UNIQUE,
+	filter text NOT NULL
+);
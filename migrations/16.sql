@@ -0,0 +1,9 @@
+CREATE TABLE folders (
+	id serial primary key NOT NULL,
+	name text NOT NULL UNIQUE
+);
+
+CREATE TABLE feeds_folders (
+	feed_id int primary key NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+	folder_id int NOT NULL REFERENCES folders(id) ON DELETE CASCADE
+);
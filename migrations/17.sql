@@ -0,0 +1,11 @@
+CREATE TABLE users (
+	id serial primary key NOT NULL,
+	username text NOT NULL UNIQUE,
+	password_hash text NOT NULL
+);
+
+CREATE TABLE sessions (
+	token_hash text primary key NOT NULL,
+	user_id int NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	expires_at timestamp with time zone NOT NULL
+);
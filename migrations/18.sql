@@ -0,0 +1,92 @@
+-- Feeds are now shared and fetched once per URL, so duplicates are merged
+-- into the oldest one. It takes over their entries, an entry of the same link
+-- being kept once with the read and starred states of all its copies, and
+-- their folder when it has none.
+CREATE TEMPORARY TABLE feed_merges AS
+SELECT id, MIN(id) OVER (PARTITION BY url) AS into_id
+FROM feeds;
+
+CREATE TEMPORARY TABLE entry_merges AS
+SELECT
+	feed_entries.id,
+	MIN(feed_entries.id) OVER (PARTITION BY feed_merges.into_id, feed_entries.link) AS into_id,
+	feed_entries.is_read,
+	feed_entries.is_starred
+FROM feed_entries, feed_merges
+WHERE feed_merges.id = feed_entries.feed_id;
+
+UPDATE feed_entries
+SET is_read = merged.is_read, is_starred = merged.is_starred
+FROM (
+	SELECT into_id, bool_or(is_read) AS is_read, bool_or(is_starred) AS is_starred
+	FROM entry_merges
+	GROUP BY into_id
+	HAVING COUNT(*) > 1
+) AS merged
+WHERE feed_entries.id = merged.into_id;
+
+DELETE FROM feed_entries
+USING entry_merges
+WHERE feed_entries.id = entry_merges.id AND entry_merges.id <> entry_merges.into_id;
+
+UPDATE feed_entries
+SET feed_id = feed_merges.into_id
+FROM feed_merges
+WHERE feed_entries.feed_id = feed_merges.id AND feed_merges.id <> feed_merges.into_id;
+
+INSERT INTO feeds_folders (feed_id, folder_id)
+SELECT DISTINCT ON (feed_merges.into_id) feed_merges.into_id, feeds_folders.folder_id
+FROM feeds_folders, feed_merges
+WHERE feeds_folders.feed_id = feed_merges.id AND feed_merges.id <> feed_merges.into_id
+ORDER BY feed_merges.into_id, feed_merges.id
+ON CONFLICT (feed_id) DO NOTHING;
+
+DELETE FROM feeds
+USING feed_merges
+WHERE feeds.id = feed_merges.id AND feed_merges.id <> feed_merges.into_id;
+
+DROP TABLE entry_merges;
+DROP TABLE feed_merges;
+ALTER TABLE feeds ADD CONSTRAINT feeds_url_key UNIQUE (url);
+
+-- Everything so far belonged to the single user of the instance: the first
+-- user there is, or the first one created when there is none yet, in which
+-- case user_id stays NULL until then.
+ALTER TABLE folders ADD COLUMN user_id int REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE folders DROP CONSTRAINT folders_name_key;
+ALTER TABLE folders ADD CONSTRAINT folders_user_id_name_key UNIQUE (user_id, name);
+UPDATE folders SET user_id = (SELECT MIN(id) FROM users);
+
+ALTER TABLE saved_views ADD COLUMN user_id int REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE saved_views DROP CONSTRAINT saved_views_name_key;
+ALTER TABLE saved_views ADD CONSTRAINT saved_views_user_id_name_key UNIQUE (user_id, name);
+UPDATE saved_views SET user_id = (SELECT MIN(id) FROM users);
+
+CREATE TABLE subscriptions (
+	user_id int REFERENCES users(id) ON DELETE CASCADE,
+	feed_id int NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+	folder_id int REFERENCES folders(id) ON DELETE SET NULL,
+	is_hidden boolean NOT NULL DEFAULT false,
+	CONSTRAINT subscriptions_user_id_feed_id_key UNIQUE (user_id, feed_id)
+);
+INSERT INTO subscriptions (user_id, feed_id, folder_id, is_hidden)
+SELECT (SELECT MIN(id) FROM users), feeds.id, feeds_folders.folder_id, feeds.is_hidden
+FROM feeds
+LEFT JOIN feeds_folders ON feeds_folders.feed_id = feeds.id;
+
+CREATE TABLE feed_entry_states (
+	user_id int REFERENCES users(id) ON DELETE CASCADE,
+	feed_entry_id int NOT NULL REFERENCES feed_entries(id) ON DELETE CASCADE,
+	is_read boolean NOT NULL DEFAULT false,
+	is_starred boolean NOT NULL DEFAULT false,
+	CONSTRAINT feed_entry_states_user_id_feed_entry_id_key UNIQUE (user_id, feed_entry_id)
+);
+INSERT INTO feed_entry_states (user_id, feed_entry_id, is_read, is_starred)
+SELECT (SELECT MIN(id) FROM users), id, is_read, is_starred
+FROM feed_entries
+WHERE is_read OR is_starred;
+
+DROP TABLE feeds_folders;
+ALTER TABLE feeds DROP COLUMN is_hidden;
+ALTER TABLE feed_entries DROP COLUMN is_read;
+ALTER TABLE feed_entries DROP COLUMN is_starred;
@@ -0,0 +1,2 @@
+-- The error of the last update of the feed, empty when it succeeded.
+ALTER TABLE feeds ADD COLUMN last_error text NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+CREATE TABLE feed_fetches (
+	id serial primary key NOT NULL,
+	feed_id int NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+	started_at timestamp with time zone NOT NULL,
+	duration_ms int NOT NULL,
+	-- 0 when no response was received.
+	status_code int NOT NULL,
+	bytes bigint NOT NULL,
+	items_seen int NOT NULL,
+	items_inserted int NOT NULL,
+	-- Empty when the fetch succeeded.
+	error text NOT NULL
+);
+
+CREATE INDEX feed_fetches_feed_id ON feed_fetches (feed_id, started_at DESC);
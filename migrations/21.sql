@@ -0,0 +1,2 @@
+-- The format of the document last fetched, such as "RSS 2.0".
+ALTER TABLE feeds ADD COLUMN format text NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+-- Retention settings belong to the subscriptions, the entries of a shared feed
+-- being kept as long as the most lenient of its subscribers asks.
+ALTER TABLE subscriptions ADD COLUMN retention_days int NOT NULL DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN retention_count int NOT NULL DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN keep_forever boolean NOT NULL DEFAULT false;
+UPDATE subscriptions
+SET
+	retention_days = feeds.retention_days,
+	retention_count = feeds.retention_count,
+	keep_forever = feeds.keep_forever
+FROM feeds
+WHERE feeds.id = subscriptions.feed_id;
+
+ALTER TABLE feeds DROP COLUMN retention_days;
+ALTER TABLE feeds DROP COLUMN retention_count;
+ALTER TABLE feeds DROP COLUMN keep_forever;
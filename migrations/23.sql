@@ -0,0 +1,3 @@
+-- The Fever API key of the user, MD5 of "username:password", hashed like the
+-- session tokens. It is set when the user is created or signs in.
+ALTER TABLE users ADD COLUMN fever_key_hash text UNIQUE;
@@ -0,0 +1,4 @@
+-- The number of updates of the feed that failed in a row, the feed being
+-- disabled after too many of them until an update succeeds.
+ALTER TABLE feeds ADD COLUMN failures int NOT NULL DEFAULT 0;
+ALTER TABLE feeds ADD COLUMN is_disabled boolean NOT NULL DEFAULT false;
@@ -0,0 +1,4 @@
+-- When the feed was marked as updating, claims older than the lease of the
+-- schedulers being left by processes that died during the update.
+ALTER TABLE feeds ADD COLUMN claimed_at timestamp with time zone;
+UPDATE feeds SET claimed_at = NOW() WHERE is_updating;
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net"
+	"net/http"
+	"path"
+	"rss-app/rss"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PublishController serves entries as RSS 2.0, Atom or JSON Feed, by the
+// extension of the request path.
+type PublishController struct{}
+
+// publishExtensions are the extensions of the documents served by
+// PublishController.
+var publishExtensions = []string{".rss", ".atom", ".json"}
+
+// published reports whether the request path asks for a published document.
+func published(r *http.Request) bool {
+	return slices.Contains(publishExtensions, path.Ext(r.URL.Path))
+}
+
+// Handle serves the entries matching the same form values as Index. The View
+// form value selects the filter of a saved view instead.
+func (p *PublishController) Handle(d *sql.DB, w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	channel := rss.Channel{Title: "Rss viewer"}
+	values := r.Form
+	if r.Form.Has("View") {
+		view := SavedView{}
+		view.Id, _ = strconv.Atoi(r.FormValue("View"))
+		err := view.load(r.Context(), d, currentUser(r).Id)
+		if err != nil {
+			http.Error(w, http.StatusText(errorStatus(err)), errorStatus(err))
+			return
+		}
+		channel.Title = view.Name
+		values = view.values(r.Form)
+	}
+
+	filter := parseFeedEntryFilter(values)
+	filter.userId = currentUser(r).Id
+	if len(filter.FeedIds) == 1 {
+		err := feedChannel(r.Context(), d, filter.FeedIds[0], filter.userId, &channel)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			panic(err)
+		}
+	}
+
+	p.publish(d, w, r, channel, filter)
+}
+
+// Feed serves the entries of the feed of the Id path value, followed by the
+// extension, filtered by the same form values as Index.
+func (p *PublishController) Feed(d *sql.DB, w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := parseFeedEntryFilter(r.Form)
+	filter.userId = currentUser(r).Id
+	id, err := strconv.Atoi(strings.TrimSuffix(r.PathValue("Id"), path.Ext(r.URL.Path)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var channel rss.Channel
+	err = feedChannel(r.Context(), d, id, filter.userId, &channel)
+	if err != nil {
+		http.Error(w, http.StatusText(errorStatus(err)), errorStatus(err))
+		return
+	}
+
+	filter.FeedIds = []int{id}
+	p.publish(d, w, r, channel, filter)
+}
+
+// View serves the entries of the saved view named by the Id path value,
+// followed by the extension.
+func (p *PublishController) View(d *sql.DB, w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	view := SavedView{Name: strings.TrimSuffix(r.PathValue("Id"), path.Ext(r.URL.Path))}
+	err = view.loadByName(r.Context(), d, currentUser(r).Id)
+	if err != nil {
+		http.Error(w, http.StatusText(errorStatus(err)), errorStatus(err))
+		return
+	}
+
+	filter := parseFeedEntryFilter(view.values(r.Form))
+	filter.userId = currentUser(r).Id
+	p.publish(d, w, r, rss.Channel{Title: view.Name}, filter)
+}
+
+// feedChannel reads the title and description of the feed the user is
+// subscribed to into channel.
+func feedChannel(ctx context.Context, d *sql.DB, feedId int, userId int, channel *rss.Channel) error {
+	return d.
+		QueryRowContext(ctx, `
+			SELECT feeds.title, feeds.description
+			FROM feeds, subscriptions
+			WHERE
+				subscriptions.feed_id = feeds.id AND
+				feeds.id = $1 AND
+				subscriptions.user_id = $2`, feedId, userId).
+		Scan(&channel.Title, &channel.Description)
+}
+
+// entryTag returns a tag URI identifying the entry on this host, standing for
+// the id of the entries without a link.
+func entryTag(r *http.Request, entryId int) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	return "tag:" + host + ",2024:entries/" + strconv.Itoa(entryId)
+}
+
+// publish writes the page of entries of filter as the document of the
+// extension of the request path.
+func (p *PublishController) publish(d *sql.DB, w http.ResponseWriter, r *http.Request, channel rss.Channel, filter FeedEntryFilter) {
+	filter.withContent = true
+	page, err := filter.page(r.Context(), d)
+	if err != nil {
+		status := errorStatus(err)
+		http.Error(w, errorMessage(r, status, err), status)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	base := scheme + "://" + r.Host
+	self := base + r.URL.RequestURI()
+	channel.Link = base + "/?" + filter.Values().Encode()
+	if channel.Description == "" {
+		channel.Description = channel.Title
+	}
+	for _, feedEntry := range page.Entries {
+		item := feedEntry.Item
+		item.Guid = entryTag(r, feedEntry.Id)
+		channel.Items = append(channel.Items, item)
+	}
+
+	var document interface{}
+	switch path.Ext(r.URL.Path) {
+	case ".rss":
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		document = rss.NewRss(channel)
+	case ".atom":
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		document = rss.NewAtom(channel, self)
+	default:
+		w.Header().Set("Content-Type", "application/feed+json")
+		err := json.NewEncoder(w).Encode(rss.NewJSONFeed(channel, self))
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	_, err = w.Write([]byte(xml.Header))
+	if err != nil {
+		panic(err)
+	}
+	err = xml.NewEncoder(w).Encode(document)
+	if err != nil {
+		panic(err)
+	}
+}
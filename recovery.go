@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// requestId returns the id given to the request by withRequestLog.
+func requestId(r *http.Request) string {
+	id, _ := r.Context().Value(requestIdContextKey).(string)
+	return id
+}
+
+// validRequestId reports whether a request id sent by a client is short and
+// plain enough to be logged as is.
+func validRequestId(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestId() string {
+	random := make([]byte, 8)
+	_, err := rand.Read(random)
+	if err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(random)
+}
+
+// withRecovery answers the requests whose handler panicked with an error
+// instead of dropping the connection. Responses already under way cannot be
+// turned into an error and have their connection aborted instead.
+func withRecovery(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			slog.ErrorContext(r.Context(), "panic", "request_id", requestId(r), "method", r.Method, "path", r.URL.Path, "error", recovered, "stack", string(debug.Stack()))
+			if recorder.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			writeError(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}()
+
+		handler.ServeHTTP(recorder, r)
+	})
+}
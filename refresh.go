@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// feedForUpdate selects the columns update needs.
+const feedForUpdate = `SELECT feeds.id, feeds.url FROM feeds`
+
+// refresh updates the feed right away, claiming it so that no scheduler
+// updates it meanwhile and making its next update due after refreshInterval.
+func (f *Feed) refresh(ctx context.Context, d *sql.DB, refreshInterval time.Duration) (int64, error) {
+	err := claimFeed(ctx, d, f.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	newEntries, err := f.update(d)
+	releaseErr := releaseFeed(d, f.Id, refreshInterval)
+
+	return newEntries, errors.Join(err, releaseErr)
+}
+
+// refreshFeed updates the feed the user is subscribed to right away and
+// returns it along with the number of new entries.
+func refreshFeed(ctx context.Context, d *sql.DB, userId int, feedId int, refreshInterval time.Duration) (*Feed, int64, error) {
+	var feed Feed
+	err := d.
+		QueryRowContext(ctx, feedForUpdate+`
+			JOIN subscriptions ON subscriptions.feed_id = feeds.id AND subscriptions.user_id = $2
+			WHERE feeds.id = $1`, feedId, userId).
+		Scan(&feed.Id, &feed.URL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	newEntries, err := feed.refresh(ctx, d, refreshInterval)
+	return &feed, newEntries, err
+}
+
+// queueRefresh makes the enabled feeds the user is subscribed to due for an
+// update, only the ones of feedIds and of the folder of folderId when given,
+// and wakes the schedulers. It returns the number of feeds queued.
+func queueRefresh(ctx context.Context, d *sql.DB, userId int, feedIds []int, folderId int) (int64, error) {
+	var args queryArgs
+	conditions := "subscriptions.feed_id = feeds.id AND feeds.is_disabled = false AND subscriptions.user_id = " + args.add(userId)
+	if len(feedIds) > 0 {
+		conditions += " AND feeds.id = ANY(" + args.add(pq.Array(feedIds)) + "::int[])"
+	}
+	if folderId != 0 {
+		conditions += " AND subscriptions.folder_id = " + args.add(folderId)
+	}
+
+	result, err := d.ExecContext(ctx, "UPDATE feeds SET update_at = NOW() FROM subscriptions WHERE "+conditions, args...)
+	if err != nil {
+		return 0, err
+	}
+	notifyFeedsDue(ctx, d)
+
+	return result.RowsAffected()
+}
+
+// refreshNotice describes the outcome of refreshing the feed.
+func refreshNotice(feed *Feed, newEntries int64, err error) (string, error) {
+	var fetchErr *fetchError
+	switch {
+	case errors.Is(err, errFeedUpdating):
+		return fmt.Sprintf("%s is already being refreshed", feed.URL), nil
+	case errors.As(err, &fetchErr):
+		return fmt.Sprintf("Could not refresh %s: %s", feed.URL, err), nil
+	case err != nil:
+		return "", err
+	case newEntries == 1:
+		return fmt.Sprintf("Refreshed %s: 1 new entry", feed.Title), nil
+	default:
+		return fmt.Sprintf("Refreshed %s: %d new entries", feed.Title, newEntries), nil
+	}
+}
+
+// refreshFeeds updates the feed whose id is given in args, or every feed, and
+// prints the outcome of each. It backs the refresh subcommand.
+func refreshFeeds(d *sql.DB, config *Config, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: rss-app refresh [FEED_ID]")
+	}
+
+	query := feedForUpdate
+	var queryArgs []any
+	if len(args) == 1 {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.New("usage: rss-app refresh [FEED_ID]")
+		}
+		query += " WHERE feeds.id = $1"
+		queryArgs = append(queryArgs, id)
+	}
+
+	rows, err := d.QueryContext(context.Background(), query+" ORDER BY feeds.id", queryArgs...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var feeds []Feed
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return rows.Err()
+			}
+			break
+		}
+		var feed Feed
+		err := rows.Scan(&feed.Id, &feed.URL)
+		if err != nil {
+			return err
+		}
+		feeds = append(feeds, feed)
+	}
+	if len(args) == 1 && len(feeds) == 0 {
+		return fmt.Errorf("no feed %s", args[0])
+	}
+
+	failed := 0
+	for _, feed := range feeds {
+		newEntries, err := feed.refresh(context.Background(), d, config.RefreshInterval)
+		if err != nil {
+			failed++
+			fmt.Printf("%d %s: %s\n", feed.Id, feed.URL, err)
+			continue
+		}
+		fmt.Printf("%d %s: %d new entries\n", feed.Id, feed.URL, newEntries)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d feeds failed", failed, len(feeds))
+	}
+
+	return nil
+}
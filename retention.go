@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// starredEntry selects the states starring feed_entries.
+const starredEntry = `
+	SELECT 1
+	FROM feed_entry_states
+	WHERE feed_entry_states.feed_entry_id = feed_entries.id AND feed_entry_states.is_starred`
+
+// feedRetention selects the retention settings of every subscribed feed, the
+// most lenient ones of its subscriptions: zero days or entries mean no limit,
+// and subscriptions without their own days use the default days of $1.
+const feedRetention = `
+	SELECT
+		feed_id,
+		bool_or(keep_forever) AS keep_forever,
+		CASE WHEN bool_or(days = 0) THEN 0 ELSE MAX(days) END AS retention_days,
+		CASE WHEN bool_or(retention_count = 0) THEN 0 ELSE MAX(retention_count) END AS retention_count
+	FROM (
+		SELECT
+			feed_id,
+			keep_forever,
+			retention_count,
+			CASE WHEN retention_days > 0 THEN retention_days ELSE $1 END AS days
+		FROM subscriptions
+	) AS settings
+	GROUP BY feed_id`
+
+// applyRetention deletes the entries that fall outside the retention settings
+// of their feed. Entries starred by any user and feeds kept forever by any
+// subscriber are never touched. The fetch history of the feeds is pruned along.
+func applyRetention(d *sql.DB, defaultDays int) error {
+	byAge, err := d.
+		ExecContext(context.Background(), `
+			DELETE FROM feed_entries
+			USING (`+feedRetention+`) AS retention
+			WHERE
+				retention.feed_id = feed_entries.feed_id AND
+				retention.keep_forever = false AND
+				retention.retention_days > 0 AND
+				NOT EXISTS (`+starredEntry+`) AND
+				feed_entries.pub_date < NOW() - make_interval(days => retention.retention_days)
+			`, defaultDays)
+	if err != nil {
+		return fmt.Errorf("delete by age: %w", err)
+	}
+
+	byCount, err := d.
+		ExecContext(context.Background(), `
+			DELETE FROM feed_entries
+			WHERE id IN (
+				SELECT id
+				FROM (
+					SELECT
+						feed_entries.id,
+						retention.retention_count,
+						ROW_NUMBER() OVER (
+							PARTITION BY feed_entries.feed_id
+							ORDER BY feed_entries.pub_date DESC, feed_entries.id DESC
+						) AS position
+					FROM feed_entries, (`+feedRetention+`) AS retention
+					WHERE
+						retention.feed_id = feed_entries.feed_id AND
+						retention.keep_forever = false AND
+						retention.retention_count > 0 AND
+						NOT EXISTS (`+starredEntry+`)
+				) AS ranked
+				WHERE position > retention_count
+			)`, defaultDays)
+	if err != nil {
+		return fmt.Errorf("delete by count: %w", err)
+	}
+
+	fetches, err := pruneFeedFetches(context.Background(), d)
+	if err != nil {
+		return fmt.Errorf("prune fetches: %w", err)
+	}
+
+	deletedByAge, _ := byAge.RowsAffected()
+	deletedByCount, _ := byCount.RowsAffected()
+	slog.Info("retention applied", "deleted_by_age", deletedByAge, "deleted_by_count", deletedByCount, "deleted_fetches", fetches)
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package rss
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+type Atom struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+type AtomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomEntry struct {
+	Id        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Author    AtomPerson `xml:"author"`
+	Links     []AtomLink `xml:"link"`
+	Summary   *AtomText  `xml:"summary,omitempty"`
+	Content   *AtomText  `xml:"content,omitempty"`
+}
+
+// NewAtom returns channel as an Atom feed published at self. Entries without
+// an author are credited to the channel and entries without a link identified
+// by their Guid, Atom requiring both.
+func NewAtom(channel Channel, self string) *Atom {
+	atom := Atom{
+		Id:    self,
+		Title: channel.Title,
+		Links: []AtomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: channel.Link, Rel: "alternate", Type: "text/html"},
+		},
+		Entries: []AtomEntry{},
+	}
+
+	var updated time.Time
+	for _, item := range channel.Items {
+		published := item.PubDate.Format(time.RFC3339)
+		entry := AtomEntry{
+			Id:        item.id(),
+			Title:     item.Title,
+			Updated:   published,
+			Published: published,
+			Author:    AtomPerson{Name: item.Author},
+		}
+		if item.Link != "" {
+			entry.Links = append(entry.Links, AtomLink{Href: item.Link, Rel: "alternate", Type: "text/html"})
+		}
+		if entry.Author.Name == "" {
+			entry.Author.Name = channel.Title
+		}
+		if item.Description != "" {
+			entry.Summary = &AtomText{Type: "html", Body: string(item.Description)}
+		}
+		if item.Content != "" {
+			entry.Content = &AtomText{Type: "html", Body: string(item.Content)}
+		}
+		if item.Enclosure.URL != "" {
+			entry.Links = append(entry.Links, AtomLink{
+				Href:   item.Enclosure.URL,
+				Rel:    "enclosure",
+				Type:   item.Enclosure.Type,
+				Length: item.Enclosure.Length,
+			})
+		}
+		if item.PubDate.After(updated) {
+			updated = item.PubDate.Time
+		}
+		atom.Entries = append(atom.Entries, entry)
+	}
+	atom.Updated = updated.Format(time.RFC3339)
+
+	return &atom
+}
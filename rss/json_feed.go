@@ -0,0 +1,67 @@
+package rss
+
+import (
+	"strconv"
+	"time"
+)
+
+// JSONFeed is a JSON Feed version 1.1 document.
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type JSONFeedItem struct {
+	Id            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	ContentHTML   string               `json:"content_html"`
+	DatePublished string               `json:"date_published,omitempty"`
+	Attachments   []JSONFeedAttachment `json:"attachments,omitempty"`
+}
+
+type JSONFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+// NewJSONFeed returns channel as a JSON Feed published at self.
+func NewJSONFeed(channel Channel, self string) *JSONFeed {
+	feed := JSONFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       channel.Title,
+		HomePageURL: channel.Link,
+		FeedURL:     self,
+		Description: channel.Description,
+		Items:       []JSONFeedItem{},
+	}
+
+	for _, item := range channel.Items {
+		jsonItem := JSONFeedItem{
+			Id:            item.id(),
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentHTML:   string(item.Content),
+			DatePublished: item.PubDate.Format(time.RFC3339),
+		}
+		if jsonItem.ContentHTML == "" {
+			jsonItem.ContentHTML = string(item.Description)
+		}
+		if item.Enclosure.URL != "" {
+			size, _ := strconv.ParseInt(item.Enclosure.Length, 10, 64)
+			jsonItem.Attachments = []JSONFeedAttachment{{
+				URL:         item.Enclosure.URL,
+				MimeType:    item.Enclosure.Type,
+				SizeInBytes: size,
+			}}
+		}
+		feed.Items = append(feed.Items, jsonItem)
+	}
+
+	return &feed
+}
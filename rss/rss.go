@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"time"
 )
@@ -48,16 +49,22 @@ func (t *RFC1123Time) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error
 	return nil
 }
 
+func (t RFC1123Time) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(t.Format(time.RFC1123Z), start)
+}
+
 type Rss struct {
-	XMLName  xml.Name  `xml:"rss"`
-	Channels []Channel `xml:"channel"`
+	XMLName   xml.Name  `xml:"rss"`
+	Version   string    `xml:"version,attr"`
+	ContentNS string    `xml:"xmlns:content,attr,omitempty"`
+	Channels  []Channel `xml:"channel"`
 }
 
 type Channel struct {
 	Title       string `xml:"title"`
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
-	Items       []Item `xml:"item"`
+	Items       []Item `xml:"item" json:",omitempty"`
 }
 
 type Item struct {
@@ -66,22 +73,120 @@ type Item struct {
 	Description template.HTML `xml:"description"`
 	Content     template.HTML `xml:"encoded"`
 	PubDate     RFC1123Time   `xml:"pubDate"`
+	Enclosure   Enclosure     `xml:"enclosure"`
+	// Author is the name the item is republished under. It is not read from
+	// the documents.
+	Author string `xml:"-" json:",omitempty"`
+	// Guid identifies the item when republished without a link. It is not
+	// read from the documents.
+	Guid string `xml:"-" json:"-"`
+}
+
+// id returns the permanent id of the item republished, its link when it has
+// one.
+func (i Item) id() string {
+	if i.Link != "" {
+		return i.Link
+	}
+
+	return i.Guid
+}
+
+// MarshalXML writes the item as RSS 2.0, Content being written as
+// content:encoded. The document must declare the content namespace, as the
+// ones made by NewRss do.
+func (i Item) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	item := struct {
+		Title       string        `xml:"title"`
+		Link        string        `xml:"link,omitempty"`
+		Guid        string        `xml:"guid,omitempty"`
+		Description template.HTML `xml:"description,omitempty"`
+		Content     template.HTML `xml:"content:encoded,omitempty"`
+		PubDate     RFC1123Time   `xml:"pubDate"`
+		Enclosure   *Enclosure    `xml:"enclosure,omitempty"`
+	}{
+		Title:       i.Title,
+		Link:        i.Link,
+		Guid:        i.Link,
+		Description: i.Description,
+		Content:     i.Content,
+		PubDate:     i.PubDate,
+	}
+	if i.Enclosure.URL != "" {
+		item.Enclosure = &i.Enclosure
+	}
+
+	return e.EncodeElement(item, start)
+}
+
+type Enclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// NewRss returns an RSS 2.0 document made of channel, ready to be marshalled.
+func NewRss(channel Channel) *Rss {
+	return &Rss{
+		Version:   "2.0",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		Channels:  []Channel{channel},
+	}
 }
 
-func New(link string) (*Rss, error) {
-	resp, err := http.Get(link)
+// UserAgent is sent along with the requests of Get.
+var UserAgent = "rss-app"
+
+// Response describes the answer to the request of Get, as far as it went.
+type Response struct {
+	StatusCode int
+	Bytes      int64
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// Get fetches and decodes the RSS document at link. The response is described
+// even when Get fails, a zero StatusCode meaning no response was received.
+func Get(link string) (*Rss, Response, error) {
+	var response Response
+	req, err := http.NewRequest(http.MethodGet, link, nil)
 	if err != nil {
-		return nil, fmt.Errorf("rss http get: %w", err)
+		return nil, response, fmt.Errorf("rss http get: %w", err)
 	}
+	req.Header.Set("User-Agent", UserAgent)
 
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, response, fmt.Errorf("rss http get: %w", err)
+	}
+	defer resp.Body.Close()
+	response.StatusCode = resp.StatusCode
+
+	if resp.StatusCode != 200 {
+		return nil, response, fmt.Errorf("rss http get: %s", resp.Status)
+	}
+
+	body := &countingReader{Reader: resp.Body}
 	var rss *Rss
-	if resp.StatusCode == 200 {
-		err := xml.NewDecoder(resp.Body).Decode(&rss)
-		if err != nil {
-			return nil, fmt.Errorf("rss xml decode: %w", err)
-		}
-		defer resp.Body.Close()
+	err = xml.NewDecoder(body).Decode(&rss)
+	response.Bytes = body.n
+	if err != nil {
+		return nil, response, fmt.Errorf("rss xml decode: %w", err)
+	}
+	if len(rss.Channels) == 0 {
+		return nil, response, errors.New("rss: no channel")
 	}
 
-	return rss, nil
+	return rss, response, nil
 }
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SavedView is a named entry filter of a user. The filter is stored in its form
+// value encoding so a view renders exactly like the equivalent Index URL.
+type SavedView struct {
+	Id          int
+	Name        string
+	Filter      url.Values
+	UnreadCount int
+}
+
+type SavedViewsController struct{}
+
+// Show renders the entry list of the view, keeping the paging form values of
+// the request.
+func (s *SavedViewsController) Show(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	view := SavedView{Id: idPathValue(r)}
+	err := view.load(r.Context(), d, currentUser(r).Id)
+	if err != nil {
+		return nil, "", err
+	}
+	r.Form = view.values(r.Form)
+
+	return Index(d, w, r)
+}
+
+// load reads the view of the user with the id of s.
+func (s *SavedView) load(ctx context.Context, d *sql.DB, userId int) error {
+	var filter string
+	err := d.
+		QueryRowContext(ctx, "SELECT name, filter FROM saved_views WHERE id = $1 AND user_id = $2", s.Id, userId).
+		Scan(&s.Name, &filter)
+	if err != nil {
+		return err
+	}
+
+	s.Filter, err = url.ParseQuery(filter)
+
+	return err
+}
+
+// loadByName reads the view of the user with the name of s.
+func (s *SavedView) loadByName(ctx context.Context, d *sql.DB, userId int) error {
+	var filter string
+	err := d.
+		QueryRowContext(ctx, "SELECT id, filter FROM saved_views WHERE name = $1 AND user_id = $2", s.Name, userId).
+		Scan(&s.Id, &filter)
+	if err != nil {
+		return err
+	}
+
+	s.Filter, err = url.ParseQuery(filter)
+
+	return err
+}
+
+// values returns the filter of the view along with the paging values of form.
+func (s *SavedView) values(form url.Values) url.Values {
+	values := url.Values{}
+	for name, value := range s.Filter {
+		values[name] = value
+	}
+	for _, name := range []string{"PageSize", "Older", "Newer"} {
+		if form.Has(name) {
+			values.Set(name, form.Get(name))
+		}
+	}
+
+	return values
+}
+
+// SetEdit saves the filter form values under the Name form value, replacing
+// the view of the same name if there is one.
+func (s *SavedViewsController) SetEdit(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	name := strings.TrimSpace(r.FormValue("Name"))
+	if name != "" {
+		_, err := d.
+			ExecContext(r.Context(), `
+				INSERT INTO saved_views (user_id, name, filter) VALUES ($1, $2, $3)
+				ON CONFLICT (user_id, name) DO UPDATE SET filter = EXCLUDED.filter`,
+				currentUser(r).Id, name, parseFeedEntryFilter(r.Form).Values().Encode())
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return Index(d, w, r)
+}
+
+// GetDelete asks to confirm deleting the view.
+func (s *SavedViewsController) GetDelete(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	view := SavedView{Id: idPathValue(r)}
+	err := view.load(r.Context(), d, currentUser(r).Id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	confirmation := Confirmation{
+		Question: "Delete the view " + view.Name + "?",
+		Action:   "/views/delete/" + strconv.Itoa(view.Id),
+		Cancel:   "/feeds/list",
+	}
+
+	return &Response{Data: confirmation}, "html/delete.html", nil
+}
+
+func (s *SavedViewsController) Delete(d *sql.DB, w http.ResponseWriter, r *http.Request) (*Response, string, error) {
+	_, err := d.
+		ExecContext(r.Context(), "DELETE FROM saved_views WHERE id = $1 AND user_id = $2", idPathValue(r), currentUser(r).Id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return Index(d, w, r)
+}
+
+// savedViews returns the saved views of the user along with their number of
+// unread entries.
+func savedViews(ctx context.Context, d *sql.DB, userId int) ([]SavedView, error) {
+	rows, err := d.QueryContext(ctx, "SELECT id, name, filter FROM saved_views WHERE user_id = $1 ORDER BY name", userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var views []SavedView
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return nil, rows.Err()
+			}
+			break
+		}
+
+		var view SavedView
+		var filter string
+		err := rows.Scan(&view.Id, &view.Name, &filter)
+		if err != nil {
+			return nil, err
+		}
+		view.Filter, err = url.ParseQuery(filter)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+
+	var filters []FeedEntryFilter
+	for _, view := range views {
+		filters = append(filters, parseFeedEntryFilter(view.Filter))
+	}
+	counts, err := unreadCounts(ctx, d, userId, filters)
+	if err != nil {
+		return nil, err
+	}
+	for i := range views {
+		views[i].UnreadCount = counts[i]
+	}
+
+	return views, nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// feedsDueChannel is the PostgreSQL channel the schedulers listen on to learn
+// that feeds became due for an update.
+const feedsDueChannel = "feeds_due"
+
+// schedulerWake wakes the scheduler of this process before its next tick.
+var schedulerWake = make(chan struct{}, 1)
+
+// wakeScheduler makes the scheduler look for due feeds right away.
+func wakeScheduler() {
+	select {
+	case schedulerWake <- struct{}{}:
+	default:
+	}
+}
+
+// notifyFeedsDue wakes the schedulers of every instance. A failure is only
+// logged since the feeds are still picked on the next tick.
+func notifyFeedsDue(ctx context.Context, d *sql.DB) {
+	wakeScheduler()
+	_, err := d.ExecContext(ctx, "NOTIFY "+feedsDueChannel)
+	if err != nil {
+		slog.WarnContext(ctx, "notify schedulers", "error", err)
+	}
+}
+
+// listen returns the notifications of the PostgreSQL channel, or nil when
+// listening fails. A nil notification is sent after reconnecting,
+// notifications having been missed.
+func listen(config *Config, channel string) (*pq.Listener, <-chan *pq.Notification) {
+	listener := pq.NewListener(config.DatabaseURL, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("listener", "channel", channel, "error", err)
+		}
+	})
+	err := listener.Listen(channel)
+	if err != nil {
+		slog.Error("listen", "channel", channel, "error", err)
+		listener.Close()
+		return nil, nil
+	}
+
+	return listener, listener.Notify
+}
+
+// updatingFeeds is the number of feeds being updated by this process.
+var updatingFeeds atomic.Int64
+
+// lastSchedulerTick is the time of the last successful scheduler tick, in
+// Unix nanoseconds.
+var lastSchedulerTick atomic.Int64
+
+// runScheduler updates the feeds due for an update on start, every poll
+// interval and when woken or notified on feedsDueChannel, and applies the
+// retention settings on start and every hour. Failures are logged and retried
+// on the next tick.
+func runScheduler(db *sql.DB, config *Config) {
+	ticker := time.NewTicker(config.PollInterval)
+	defer ticker.Stop()
+
+	// Without a listener the scheduler only wakes on its ticks.
+	listener, notifications := listen(config, feedsDueChannel)
+	if listener != nil {
+		defer listener.Close()
+	}
+
+	retentionTicker := time.NewTicker(time.Hour)
+	defer retentionTicker.Stop()
+
+	tick := func() {
+		err := updateDueFeeds(db, config)
+		if err != nil {
+			slog.Error("scheduler tick failed", "error", err)
+			return
+		}
+		lastSchedulerTick.Store(time.Now().UnixNano())
+	}
+
+	retention := func() {
+		err := applyRetention(db, config.RetentionDays)
+		if err != nil {
+			slog.Error("retention failed", "error", err)
+		}
+	}
+
+	tick()
+	retention()
+	for {
+		select {
+		case <-ticker.C:
+			if listener != nil {
+				go listener.Ping()
+			}
+			tick()
+		case <-schedulerWake:
+			tick()
+		case <-notifications:
+			tick()
+		case <-retentionTicker.C:
+			retention()
+		}
+	}
+}
+
+// updateDueFeeds starts updating the feeds whose update time has come, as many
+// as FetchConcurrency allows next to the ones already being updated. The feeds
+// are marked as updating in the same statement so no other tick picks them
+// until they are released or feedClaimLease has passed.
+func updateDueFeeds(db *sql.DB, config *Config) error {
+	slots := int64(config.FetchConcurrency) - updatingFeeds.Load()
+	if slots <= 0 {
+		slog.Debug("scheduler tick", "due_feeds", 0, "updating_feeds", updatingFeeds.Load())
+		return nil
+	}
+
+	rows, err := db.QueryContext(context.Background(), `
+		UPDATE feeds
+		SET is_updating = true, claimed_at = NOW()
+		WHERE id IN (
+			SELECT id
+			FROM feeds 
+			WHERE 
+				update_at < NOW() AND
+				`+unclaimedFeed+` AND
+				is_disabled = false
+			ORDER BY update_at, id 
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, url`, slots, feedClaimLease.Seconds())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var feeds []Feed
+	for {
+		if !rows.Next() {
+			if rows.Err() != nil {
+				return rows.Err()
+			}
+			break
+		}
+
+		var feed Feed
+		err := rows.Scan(&feed.Id, &feed.URL)
+		if err != nil {
+			return err
+		}
+		feeds = append(feeds, feed)
+	}
+	slog.Debug("scheduler tick", "due_feeds", len(feeds), "updating_feeds", updatingFeeds.Load())
+
+	for _, feed := range feeds {
+		updatingFeeds.Add(1)
+		go updateFeed(db, config, feed)
+	}
+
+	return nil
+}
+
+// updateFeed updates the feed marked as updating and schedules its next
+// update, even when this one failed so a broken feed does not stay locked. The
+// scheduler is woken afterwards to take on the feeds still due.
+func updateFeed(db *sql.DB, config *Config, feed Feed) {
+	defer wakeScheduler()
+	defer updatingFeeds.Add(-1)
+
+	// update logs its own outcome.
+	feed.update(db)
+
+	err := releaseFeed(db, feed.Id, config.RefreshInterval)
+	if err != nil {
+		slog.Error("unlock feed", "feed_id", feed.Id, "error", err)
+	}
+}
+
+// feedClaimLease is how long a feed stays marked as updating at most, the
+// claims of processes that died during an update expiring after it.
+const feedClaimLease = 15 * time.Minute
+
+// unclaimedFeed selects the feeds not being updated, the lease being $2.
+const unclaimedFeed = "(is_updating = false OR claimed_at < NOW() - make_interval(secs => $2))"
+
+// errFeedUpdating is returned by claimFeed for a feed already being updated.
+var errFeedUpdating = errors.New("the feed is already being updated")
+
+// claimFeed marks the feed as being updated like updateDueFeeds does for the
+// feeds it picks, so no scheduler picks it until releaseFeed is called.
+func claimFeed(ctx context.Context, d *sql.DB, feedId int) error {
+	result, err := d.
+		ExecContext(ctx, "UPDATE feeds SET is_updating = true, claimed_at = NOW() WHERE id = $1 AND "+unclaimedFeed,
+			feedId, feedClaimLease.Seconds())
+	if err != nil {
+		return err
+	}
+
+	err = rowAffected(result)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errFeedUpdating
+	}
+
+	return err
+}
+
+// releaseFeed ends the update of the feed, the next one being due after
+// refreshInterval.
+func releaseFeed(d *sql.DB, feedId int, refreshInterval time.Duration) error {
+	_, err := d.Exec("UPDATE feeds SET is_updating = false, claimed_at = NULL, update_at = NOW() + make_interval(secs => $2) WHERE id = $1", feedId, refreshInterval.Seconds())
+
+	return err
+}
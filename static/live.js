@@ -0,0 +1,57 @@
+// Shows a banner when entries matching the list arrived, loading them in when
+// clicked. The list is looked up again once the feeds are done updating, so
+// the count follows the filters of the page.
+(function () {
+	const banner = document.getElementById("live");
+	const entries = document.getElementById("entries");
+	if (!banner || !entries || !window.EventSource) {
+		return;
+	}
+	const button = banner.querySelector("button");
+
+	let pending = null;
+	let timer = null;
+
+	function entryIds(root) {
+		return new Set(Array.from(root.querySelectorAll("[data-entry]"), (entry) => entry.dataset.entry));
+	}
+
+	async function check() {
+		timer = null;
+		const response = await fetch(banner.dataset.src, { credentials: "same-origin" });
+		if (!response.ok) {
+			return;
+		}
+		const page = new DOMParser().parseFromString(await response.text(), "text/html");
+		const fresh = page.getElementById("entries");
+		if (!fresh) {
+			return;
+		}
+
+		const shown = entryIds(entries);
+		let count = 0;
+		for (const id of entryIds(fresh)) {
+			if (!shown.has(id)) {
+				count++;
+			}
+		}
+		pending = count > 0 ? fresh : null;
+		button.textContent = count === 1 ? "1 new entry" : count + " new entries";
+		banner.hidden = count === 0;
+	}
+
+	button.addEventListener("click", () => {
+		if (pending) {
+			entries.replaceChildren(...pending.childNodes);
+		}
+		pending = null;
+		banner.hidden = true;
+	});
+
+	new EventSource("/events").addEventListener("new_entries", () => {
+		// Feeds are often updated several in a row.
+		if (timer === null) {
+			timer = setTimeout(check, 2000);
+		}
+	});
+})();
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const sessionDuration = 30 * 24 * time.Hour
+
+var errInvalidCredentials = errors.New("invalid username or password")
+
+// dummyPasswordHash is compared against when the username is unknown, so that
+// failing logins take the same time whether the user exists or not.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+type User struct {
+	Id       int
+	Username string
+}
+
+func createUser(ctx context.Context, d *sql.DB, username string, password string) (*User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || password == "" {
+		return nil, errors.New("username and password are required")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user := User{Username: username}
+	err = tx.
+		QueryRowContext(ctx, "INSERT INTO users (username, password_hash, fever_key_hash) VALUES ($1, $2, $3) RETURNING id",
+			username, string(hash), hashSessionToken(feverAPIKey(username, password))).
+		Scan(&user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first user takes over the subscriptions, states, folders and views
+	// created before there were users.
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count == 1 {
+		for _, table := range []string{"subscriptions", "feed_entry_states", "folders", "saved_views"} {
+			_, err := tx.ExecContext(ctx, "UPDATE "+table+" SET user_id = $1 WHERE user_id IS NULL", user.Id)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// authenticateUser returns the user with username and password, failing with
+// errInvalidCredentials when there is none.
+func authenticateUser(ctx context.Context, d *sql.DB, username string, password string) (*User, error) {
+	user := User{Username: username}
+	var hash string
+	err := d.
+		QueryRowContext(ctx, "SELECT id, password_hash FROM users WHERE username = $1", username).
+		Scan(&user.Id, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, errInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		return nil, errInvalidCredentials
+	}
+
+	return &user, nil
+}
+
+// userById returns the user with the id, failing with sql.ErrNoRows when there
+// is none.
+func userById(ctx context.Context, d *sql.DB, id int) (*User, error) {
+	user := User{Id: id}
+	err := d.QueryRowContext(ctx, "SELECT username FROM users WHERE id = $1", id).Scan(&user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// feverAPIKey returns the key Fever clients sign in with, the MD5 of the
+// username and password.
+func feverAPIKey(username string, password string) string {
+	sum := md5.Sum([]byte(username + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// setFeverKey stores the Fever API key of the user with password, for the
+// users created before there were Fever keys.
+func (u *User) setFeverKey(ctx context.Context, d *sql.DB, password string) error {
+	_, err := d.
+		ExecContext(ctx, "UPDATE users SET fever_key_hash = $1 WHERE id = $2",
+			hashSessionToken(feverAPIKey(u.Username, password)), u.Id)
+
+	return err
+}
+
+// feverUser returns the user of the Fever API key, failing with sql.ErrNoRows
+// when there is none.
+func feverUser(ctx context.Context, d *sql.DB, apiKey string) (*User, error) {
+	var user User
+	err := d.
+		QueryRowContext(ctx, "SELECT id, username FROM users WHERE fever_key_hash = $1", hashSessionToken(apiKey)).
+		Scan(&user.Id, &user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// hashSessionToken returns the form session tokens are stored in, so that the
+// sessions table alone does not allow signing in.
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSession starts a session for the user and returns its token.
+func (u *User) newSession(ctx context.Context, d *sql.DB) (string, time.Time, error) {
+	random := make([]byte, 32)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	expiresAt := time.Now().Add(sessionDuration)
+
+	_, err = d.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at < NOW()")
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	_, err = d.
+		ExecContext(ctx, "INSERT INTO sessions (token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+			hashSessionToken(token), u.Id, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// sessionUser returns the user of the session token, failing with
+// sql.ErrNoRows when the session does not exist or has expired.
+func sessionUser(ctx context.Context, d *sql.DB, token string) (*User, error) {
+	var user User
+	err := d.
+		QueryRowContext(ctx, `
+			SELECT users.id, users.username
+			FROM sessions, users
+			WHERE
+				users.id = sessions.user_id AND
+				sessions.token_hash = $1 AND
+				sessions.expires_at > NOW()`, hashSessionToken(token)).
+		Scan(&user.Id, &user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func deleteSession(ctx context.Context, d *sql.DB, token string) error {
+	_, err := d.ExecContext(ctx, "DELETE FROM sessions WHERE token_hash = $1", hashSessionToken(token))
+	return err
+}
+
+// addUser creates the user named by args, reading its password from the first
+// line of standard input.
+func addUser(d *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: rss-app useradd USERNAME < password")
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	_, err = createUser(context.Background(), d, args[0], strings.TrimRight(password, "\r\n"))
+	return err
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
 	"net/http"
 	"strconv"
 )
@@ -22,3 +24,33 @@ func idPathValue(r *http.Request) int {
 
 	return id
 }
+
+// rowAffected returns sql.ErrNoRows when the statement of result changed no
+// row.
+func rowAffected(result sql.Result) error {
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// countFormValue returns the form value named name as a count, 0 when it is
+// empty, failing with a bad request when it is not a number or is negative.
+func countFormValue(r *http.Request, name string) (int, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return 0, badRequest(fmt.Errorf("%s: %q is not a positive number", name, value))
+	}
+
+	return count, nil
+}